@@ -0,0 +1,199 @@
+package index
+
+import (
+	"container/list"
+	"encoding/binary"
+	"sort"
+	"sync"
+)
+
+// CacheStats are the counters of the query cache of a TokenSetSearcher.
+type CacheStats struct {
+	Hits, Misses int64
+	// Number of cached doc lists.
+	Entries int
+}
+
+// queryCache is an LRU cache of the intersected doc lists of conjunctions of
+// terms. It has its own mutex, so that concurrent searches can share it.
+type queryCache struct {
+	mu       sync.Mutex
+	capacity int
+	// list of *cacheEntry, the most recently used at the front
+	lru     *list.List
+	entries map[string]*list.Element
+	// map from term to the cache keys of entries containing the term
+	byTerm       map[termKey]map[string]bool
+	hits, misses int64
+}
+
+type cacheEntry struct {
+	key   string
+	terms []termKey
+	docs  []int32
+}
+
+func newQueryCache(capacity int) *queryCache {
+	return &queryCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		byTerm:   make(map[termKey]map[string]bool),
+	}
+}
+
+// cacheKey returns the normalized key of a conjunction of terms, and the
+// sorted distinct terms. Each term is encoded as the uvarint field ID and the
+// uvarint length of the token followed by the token, so different
+// conjunctions never have the same key.
+func cacheKey(terms []termKey) (string, []termKey) {
+	terms = append([]termKey(nil), terms...)
+	sort.Slice(terms, func(i, j int) bool {
+		a, b := terms[i], terms[j]
+		return a.field < b.field || a.field == b.field && a.token < b.token
+	})
+	distinct := terms[:0]
+	var key []byte
+	var buf [binary.MaxVarintLen64]byte
+	for i, term := range terms {
+		if i > 0 && term == terms[i-1] {
+			continue
+		}
+		distinct = append(distinct, term)
+		key = append(key, buf[:binary.PutUvarint(buf[:], uint64(term.field))]...)
+		key = append(key, buf[:binary.PutUvarint(buf[:], uint64(len(term.token)))]...)
+		key = append(key, term.token...)
+	}
+	return string(key), distinct
+}
+
+// get returns the cached doc list of key, and whether it is found.
+func (c *queryCache) get(key string) ([]int32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry).docs, true
+}
+
+// put caches docs of the conjunction of terms, evicting the least recently
+// used entries if the cache is full.
+func (c *queryCache) put(key string, terms []termKey, docs []int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*cacheEntry).docs = docs
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, terms: terms, docs: docs})
+	for _, term := range terms {
+		keys := c.byTerm[term]
+		if keys == nil {
+			keys = make(map[string]bool)
+			c.byTerm[term] = keys
+		}
+		keys[key] = true
+	}
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove removes an entry. c.mu must be held.
+func (c *queryCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	for _, term := range e.terms {
+		keys := c.byTerm[term]
+		delete(keys, e.key)
+		if len(keys) == 0 {
+			delete(c.byTerm, term)
+		}
+	}
+}
+
+// invalidate removes the entries containing term.
+func (c *queryCache) invalidate(term termKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.byTerm[term] {
+		c.remove(c.entries[key])
+	}
+}
+
+// clear removes all the entries, keeping the counters.
+func (c *queryCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.byTerm = make(map[termKey]map[string]bool)
+}
+
+func (c *queryCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.lru.Len()}
+}
+
+// EnableCache enables an LRU cache of at most capacity intersected doc lists
+// of conjunctive queries, which is used by Search, and SearchQuery for an And
+// of Terms. A non-positive capacity disables the cache.
+//
+// A cached list is invalidated when a doc is added with any of its terms.
+// Deleting docs does not invalidate lists, since deleted docs are filtered
+// out after intersecting. The cache is cleared by Compact and Load.
+func (s *TokenSetSearcher) EnableCache(capacity int) {
+	if capacity <= 0 {
+		s.cache = nil
+		return
+	}
+	s.cache = newQueryCache(capacity)
+}
+
+// CacheStats returns the counters of the cache. Zero stats are returned if
+// the cache is disabled.
+func (s *TokenSetSearcher) CacheStats() CacheStats {
+	if s.cache == nil {
+		return CacheStats{}
+	}
+	return s.cache.stats()
+}
+
+// cachedIntersection returns the intersected doc list, including deleted
+// docs, of terms from the cache, computing and caching it on a miss. ok is
+// false if the cache is disabled, or there is a single distinct term, whose
+// compressed inverted list is used directly.
+func (s *TokenSetSearcher) cachedIntersection(terms []termKey) (docs []int32, ok bool) {
+	if s.cache == nil {
+		return nil, false
+	}
+	key, terms := cacheKey(terms)
+	if len(terms) < 2 {
+		return nil, false
+	}
+	if docs, ok := s.cache.get(key); ok {
+		return docs, true
+	}
+	iters := make([]docIterator, len(terms))
+	for i, term := range terms {
+		iters[i] = s.fields[term.field].inverted[term.token].iterator()
+	}
+	intersectDocs(iters, func(docID int32) error {
+		docs = append(docs, docID)
+		return nil
+	})
+	s.cache.put(key, terms, docs)
+	return docs, true
+}
@@ -0,0 +1,115 @@
+package index
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func searchDocs(t *testing.T, sch *TokenSetSearcher, query map[string]stringsp.Set) []int32 {
+	var docs []int32
+	assert.NoError(t, sch.Search(query, func(docID int32, data interface{}) error {
+		docs = append(docs, docID)
+		return nil
+	}))
+	return docs
+}
+
+func TestTokenSetSearcher_Cache(t *testing.T) {
+	sch := indexDocs([][2]string{
+		{"0", "net http server"},
+		{"1", "gorilla mux http"},
+		{"2", "gorilla websocket"},
+		{"3", "net rpc"},
+	})
+	assert.Equal(t, "stats", sch.CacheStats(), CacheStats{})
+	sch.EnableCache(2)
+
+	httpNet := SingleFieldQuery("text", "http", "net")
+	assert.StringEqual(t, "http net", searchDocs(t, sch, httpNet), "[0]")
+	assert.Equal(t, "stats", sch.CacheStats(), CacheStats{Misses: 1, Entries: 1})
+	assert.StringEqual(t, "http net", searchDocs(t, sch, httpNet), "[0]")
+	// the same normalized query
+	assert.StringEqual(t, "net http", searchQueryDocs(t, sch, And{
+		Term{"text", "net"}, Term{"text", "http"}, Term{"text", "net"},
+	}), "[0]")
+	assert.Equal(t, "stats", sch.CacheStats(), CacheStats{Hits: 2, Misses: 1, Entries: 1})
+	// single terms are not cached
+	assert.StringEqual(t, "net", searchDocs(t, sch, SingleFieldQuery("text", "net")), "[0 3]")
+	assert.StringEqual(t, "net net", searchQueryDocs(t, sch, And{Term{"text", "net"}, Term{"text", "net"}}), "[0 3]")
+	assert.Equal(t, "stats", sch.CacheStats(), CacheStats{Hits: 2, Misses: 1, Entries: 1})
+
+	// deleted docs are filtered out of cached lists
+	assert.NoError(t, sch.DeleteDoc(0))
+	assert.StringEqual(t, "http net", searchDocs(t, sch, httpNet), "[]")
+	assert.Equal(t, "stats", sch.CacheStats(), CacheStats{Hits: 3, Misses: 1, Entries: 1})
+
+	// adding docs with a cached token invalidates the lists
+	gorillaHTTP := SingleFieldQuery("text", "gorilla", "http")
+	assert.StringEqual(t, "gorilla http", searchDocs(t, sch, gorillaHTTP), "[1]")
+	sch.AddDoc(map[string]stringsp.Set{"text": stringsp.NewSet("net", "http")}, nil)
+	assert.Equal(t, "Entries", sch.CacheStats().Entries, 0)
+	assert.StringEqual(t, "http net", searchDocs(t, sch, httpNet), "[4]")
+	assert.StringEqual(t, "gorilla http", searchDocs(t, sch, gorillaHTTP), "[1]")
+	assert.Equal(t, "stats", sch.CacheStats(), CacheStats{Hits: 3, Misses: 4, Entries: 2})
+
+	// the least recently used one is evicted
+	assert.StringEqual(t, "net rpc", searchDocs(t, sch, SingleFieldQuery("text", "net", "rpc")), "[3]")
+	assert.StringEqual(t, "gorilla http", searchDocs(t, sch, gorillaHTTP), "[1]")
+	assert.StringEqual(t, "http net", searchDocs(t, sch, httpNet), "[4]")
+	assert.Equal(t, "stats", sch.CacheStats(), CacheStats{Hits: 4, Misses: 6, Entries: 2})
+
+	sch.Compact()
+	assert.Equal(t, "Entries", sch.CacheStats().Entries, 0)
+	assert.StringEqual(t, "http net", searchDocs(t, sch, httpNet), "[3]")
+
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.NoErrorOrDie(t, sch.Load(bytes.NewReader(b)))
+	assert.Equal(t, "Entries", sch.CacheStats().Entries, 0)
+	assert.StringEqual(t, "http net", searchDocs(t, sch, httpNet), "[3]")
+	assert.Equal(t, "Entries", sch.CacheStats().Entries, 1)
+
+	sch.EnableCache(0)
+	assert.Equal(t, "stats", sch.CacheStats(), CacheStats{})
+	assert.StringEqual(t, "http net", searchDocs(t, sch, httpNet), "[3]")
+}
+
+func TestSyncTokenSetSearcher_Cache(t *testing.T) {
+	var ss SyncTokenSetSearcher
+	ss.EnableCache(16)
+	// searches of a field not existing are not cached
+	ss.AddDoc(map[string]stringsp.Set{"text": stringsp.NewSet("a", "b")}, 0)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i < 1000; i++ {
+			tokens := stringsp.NewSet("a")
+			if i%2 == 0 {
+				tokens.Add("b")
+			}
+			ss.AddDoc(map[string]stringsp.Set{"text": tokens}, i)
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				ss.View(func(s *TokenSetSearcher) error {
+					cnt := len(searchDocs(t, s, SingleFieldQuery("text", "a", "b")))
+					assert.Equal(t, "cnt", cnt, (s.DocCount()+1)/2)
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	stats := ss.CacheStats()
+	assert.Equal(t, "Hits+Misses", stats.Hits+stats.Misses, int64(400))
+}
@@ -0,0 +1,278 @@
+package index
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path"
+
+	"github.com/golangplus/errors"
+	"github.com/golangplus/strings"
+)
+
+const (
+	dsDocsDir       = "docs"
+	dsPostingsDir   = "postings"
+	dsTermsFilename = "terms"
+)
+
+var (
+	// error of an inverted list read from the disk with a corrupted header
+	ErrCorruptedPostings = errors.New("Corrupted posting list")
+)
+
+// diskSearcherMeta is saved in the terms file of a DiskTokenSetSearcher.
+type diskSearcherMeta struct {
+	// number of docs, including deleted ones
+	Docs    int
+	Deleted []int32
+	// map from field to token to the index in the postings array
+	Fields map[string]map[string]int
+}
+
+// SaveToDir saves the searcher into dir in the format opened by
+// OpenDiskTokenSetSearcher. Documents are stored in a ConstArray under
+// dir/docs, inverted lists in another ConstArray under dir/postings, and the
+// term dictionary in dir/terms.
+//
+// Only docs, inverted lists and deletions are saved. Token positions, numeric
+// fields and string sort values are dropped, so phrase, proximity, range and
+// sorted searches are not supported on the saved index.
+func (s *TokenSetSearcher) SaveToDir(dir string) error {
+	docs, err := CreateConstArray(path.Join(dir, dsDocsDir))
+	if err != nil {
+		return err
+	}
+	for docID := range s.docs {
+		data, err := s.doc(int32(docID))
+		if err == nil {
+			_, err = docs.AppendGob(data)
+		}
+		if err != nil {
+			docs.Close()
+			return err
+		}
+	}
+	if err := docs.Close(); err != nil {
+		return err
+	}
+
+	pw, err := createPostingsWriter(path.Join(dir, dsPostingsDir))
+	if err != nil {
+		return err
+	}
+	for _, fi := range s.fields {
+		for token, l := range fi.inverted {
+			if err := pw.append(fi.name, token, l); err != nil {
+				pw.close()
+				return err
+			}
+		}
+	}
+	if err := pw.close(); err != nil {
+		return err
+	}
+	meta := diskSearcherMeta{
+		Docs:   len(s.docs),
+		Fields: pw.terms,
+	}
+	for docID := range s.deleted {
+		meta.Deleted = append(meta.Deleted, docID)
+	}
+	return writeDiskSearcherMeta(dir, &meta)
+}
+
+// postingsWriter writes inverted lists into a ConstArray, each element of
+// which is the uvarint encoded length followed by the data of a list.
+type postingsWriter struct {
+	ca *ConstArrayWriter
+	// map from field to token to the index in the array
+	terms map[string]map[string]int
+	buf   [binary.MaxVarintLen64]byte
+}
+
+func createPostingsWriter(dir string) (*postingsWriter, error) {
+	ca, err := CreateConstArray(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &postingsWriter{ca: ca, terms: make(map[string]map[string]int)}, nil
+}
+
+func (pw *postingsWriter) append(field, token string, l *postingList) error {
+	n := binary.PutUvarint(pw.buf[:], uint64(l.n))
+	idx, err := pw.ca.AppendBytes(append(pw.buf[:n:n], l.data...))
+	if err != nil {
+		return err
+	}
+	tokens := pw.terms[field]
+	if tokens == nil {
+		tokens = make(map[string]int)
+		pw.terms[field] = tokens
+	}
+	tokens[token] = idx
+	return nil
+}
+
+func (pw *postingsWriter) close() error {
+	return pw.ca.Close()
+}
+
+// writeDiskSearcherMeta writes the terms file in dir.
+func writeDiskSearcherMeta(dir string, meta *diskSearcherMeta) error {
+	f, err := os.Create(path.Join(dir, dsTermsFilename))
+	if err != nil {
+		return errorsp.WithStacks(err)
+	}
+	if err := gob.NewEncoder(f).Encode(meta); err != nil {
+		f.Close()
+		return errorsp.WithStacks(err)
+	}
+	return errorsp.WithStacks(f.Close())
+}
+
+// DiskTokenSetSearcher is a read-only searcher with data saved by
+// TokenSetSearcher.SaveToDir. Only the term dictionary is loaded into memory
+// when opening. Inverted lists and documents are read from the disk when
+// searching.
+//
+// A DiskTokenSetSearcher is safe for concurrent use.
+type DiskTokenSetSearcher struct {
+	docs     *ConstArrayReader
+	postings *ConstArrayReader
+	docCount int
+	deleted  map[int32]bool
+	// map from field to token to the index in postings
+	terms map[string]map[string]int
+}
+
+// OpenDiskTokenSetSearcher opens a DiskTokenSetSearcher saved in dir.
+func OpenDiskTokenSetSearcher(dir string) (*DiskTokenSetSearcher, error) {
+	f, err := os.Open(path.Join(dir, dsTermsFilename))
+	if err != nil {
+		return nil, errorsp.WithStacks(err)
+	}
+	defer f.Close()
+	var meta diskSearcherMeta
+	if err := gob.NewDecoder(f).Decode(&meta); err != nil {
+		return nil, errorsp.WithStacks(err)
+	}
+	docs, err := OpenConstArray(path.Join(dir, dsDocsDir))
+	if err != nil {
+		return nil, err
+	}
+	postings, err := OpenConstArray(path.Join(dir, dsPostingsDir))
+	if err != nil {
+		docs.Close()
+		return nil, err
+	}
+	ds := &DiskTokenSetSearcher{
+		docs:     docs,
+		postings: postings,
+		docCount: meta.Docs,
+		deleted:  make(map[int32]bool, len(meta.Deleted)),
+		terms:    meta.Fields,
+	}
+	for _, docID := range meta.Deleted {
+		ds.deleted[docID] = true
+	}
+	return ds, nil
+}
+
+// Close closes the opened files.
+func (ds *DiskTokenSetSearcher) Close() error {
+	err := ds.docs.Close()
+	if e := ds.postings.Close(); e != nil {
+		err = e
+	}
+	return err
+}
+
+// postingList reads the inverted list of a token in field. A nil list is
+// returned if the token does not exist.
+func (ds *DiskTokenSetSearcher) postingList(field, token string) (*postingList, error) {
+	idx, ok := ds.terms[field][token]
+	if !ok {
+		return nil, nil
+	}
+	bs, err := ds.postings.GetBytes(idx)
+	if err != nil {
+		return nil, err
+	}
+	n, sz := binary.Uvarint(bs)
+	// every docID takes at least one byte
+	if sz <= 0 || n > uint64(len(bs)-sz) {
+		return nil, ErrCorruptedPostings
+	}
+	l := &postingList{data: bs[sz:], n: int(n)}
+	if !l.buildIndex(ds.docCount) {
+		return nil, ErrCorruptedPostings
+	}
+	return l, nil
+}
+
+// Search has the same semantics as TokenSetSearcher.Search. Only the inverted
+// lists of the tokens in query, and the data of hit documents are read, and
+// hits are output as they are found.
+func (ds *DiskTokenSetSearcher) Search(query map[string]stringsp.Set, output func(docID int32, data interface{}) error) error {
+	return ds.searchDocs(query, func(docID int32) error {
+		data, err := ds.docs.GetGob(int(docID))
+		if err != nil {
+			return err
+		}
+		return output(docID, data)
+	})
+}
+
+// searchDocs calls output with the docIDs matching query, excluding deleted
+// ones, in increasing order. Only inverted lists are read.
+func (ds *DiskTokenSetSearcher) searchDocs(query map[string]stringsp.Set, output func(docID int32) error) error {
+	var iters []docIterator
+	for fld, tks := range query {
+		for tk := range tks {
+			l, err := ds.postingList(fld, tk)
+			if err != nil {
+				return err
+			}
+			if l.len() == 0 {
+				// one of the inverted is empty, no results
+				return nil
+			}
+			iters = append(iters, l.iterator())
+		}
+	}
+	if len(iters) == 0 {
+		iters = append(iters, newRangeIterator(ds.docCount))
+	}
+	return intersectDocs(iters, func(docID int32) error {
+		if ds.deleted[docID] {
+			return nil
+		}
+		return output(docID)
+	})
+}
+
+// DocInfo returns the doc-info of specified doc. ErrInvalidDocID is returned
+// if the doc does not exist or was deleted.
+func (ds *DiskTokenSetSearcher) DocInfo(docID int32) (interface{}, error) {
+	if docID < 0 || int(docID) >= ds.docCount || ds.deleted[docID] {
+		return nil, ErrInvalidDocID
+	}
+	return ds.docs.GetGob(int(docID))
+}
+
+// DocCount returns the number of docs, excluding deleted ones.
+func (ds *DiskTokenSetSearcher) DocCount() int {
+	return ds.docCount - len(ds.deleted)
+}
+
+// TokenDocList returns the docIDs of a specified token, including deleted
+// ones.
+func (ds *DiskTokenSetSearcher) TokenDocList(field, token string) ([]int32, error) {
+	l, err := ds.postingList(field, token)
+	if err != nil {
+		return nil, err
+	}
+	return l.docIDs(), nil
+}
@@ -0,0 +1,102 @@
+package index
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestDiskTokenSetSearcher(t *testing.T) {
+	sch := indexDocs([][2]string{
+		{"To friends", "hello my friend"},
+		{"To dogs", "GO go go, my dog"},
+		{"To cats", "hello my cat"},
+	})
+	assert.NoError(t, sch.DeleteDoc(2))
+
+	dir := path.Join(os.TempDir(), "TestDiskTokenSetSearcher")
+	assert.NoErrorOrDie(t, os.RemoveAll(dir))
+	assert.NoErrorOrDie(t, sch.SaveToDir(dir))
+
+	ds, err := OpenDiskTokenSetSearcher(dir)
+	assert.NoErrorOrDie(t, err)
+	defer func() {
+		assert.NoError(t, ds.Close())
+	}()
+
+	assert.Equal(t, "DocCount", ds.DocCount(), 2)
+	info, err := ds.DocInfo(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "DocInfo(1)", info.(*DocInfo).A, "2 - To dogs")
+	_, err = ds.DocInfo(2)
+	assert.Equal(t, "DocInfo(2)", err, ErrInvalidDocID)
+
+	docs, err := ds.TokenDocList("text", "my")
+	assert.NoError(t, err)
+	assert.StringEqual(t, "my", docs, "[0 1 2]")
+
+	var infos []string
+	search := func(query map[string]stringsp.Set) []int32 {
+		var docs []int32
+		infos = nil
+		assert.NoError(t, ds.Search(query, func(docID int32, data interface{}) error {
+			docs = append(docs, docID)
+			infos = append(infos, data.(*DocInfo).A)
+			return nil
+		}))
+		return docs
+	}
+	assert.StringEqual(t, "my", search(SingleFieldQuery("text", "my")), "[0 1]")
+	assert.StringEqual(t, "infos", infos, "[1 - To friends 2 - To dogs]")
+	assert.StringEqual(t, "my dog", search(SingleFieldQuery("text", "my", "dog")), "[1]")
+	assert.StringEqual(t, "hello cat", search(SingleFieldQuery("text", "hello", "cat")), "[]")
+	assert.StringEqual(t, "missing", search(SingleFieldQuery("text", "missing")), "[]")
+	assert.StringEqual(t, "all", search(nil), "[0 1]")
+
+	e := errors.New("stop")
+	assert.Equal(t, "error", ds.Search(nil, func(int32, interface{}) error {
+		return e
+	}), e)
+
+	// the search stops at the first hit
+	cnt := 0
+	assert.Equal(t, "error", ds.Search(SingleFieldQuery("text", "my"), func(int32, interface{}) error {
+		cnt++
+		return e
+	}), e)
+	assert.Equal(t, "cnt", cnt, 1)
+}
+
+func TestDiskTokenSetSearcher_CorruptedPostings(t *testing.T) {
+	dir := path.Join(os.TempDir(), "TestDiskTokenSetSearcher_CorruptedPostings")
+	assert.NoErrorOrDie(t, os.RemoveAll(dir))
+	assert.NoErrorOrDie(t, indexDocs([][2]string{{"0", "a"}}).SaveToDir(dir))
+
+	ca, err := CreateConstArray(path.Join(dir, dsPostingsDir))
+	assert.NoErrorOrDie(t, err)
+	// a truncated uvarint, and a length longer than the data
+	for _, bs := range [][]byte{{0x80}, {5, 0}} {
+		_, err := ca.AppendBytes(bs)
+		assert.NoErrorOrDie(t, err)
+	}
+	assert.NoErrorOrDie(t, ca.Close())
+	assert.NoErrorOrDie(t, writeDiskSearcherMeta(dir, &diskSearcherMeta{
+		Docs:   1,
+		Fields: map[string]map[string]int{"text": {"uvarint": 0, "length": 1}},
+	}))
+
+	ds, err := OpenDiskTokenSetSearcher(dir)
+	assert.NoErrorOrDie(t, err)
+	defer ds.Close()
+	for _, token := range []string{"uvarint", "length"} {
+		_, err = ds.TokenDocList("text", token)
+		assert.Equal(t, token, err, ErrCorruptedPostings)
+		assert.Equal(t, token, ds.Search(SingleFieldQuery("text", token), func(int32, interface{}) error {
+			return nil
+		}), ErrCorruptedPostings)
+	}
+}
@@ -0,0 +1,195 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Explanation explains whether a node of a query matches a document.
+type Explanation struct {
+	// The node in the query syntax of ParseQuery, or AND, OR and NOT for
+	// boolean nodes.
+	Query   string `json:"query"`
+	Matched bool   `json:"matched"`
+	// Length of the posting list of a Term, including deleted docs. It is
+	// zero for other nodes.
+	PostingLen int `json:"postingLen,omitempty"`
+	// Number of live docs matching the node.
+	DocFreq  int            `json:"docFreq"`
+	Children []*Explanation `json:"children,omitempty"`
+}
+
+// DocExplanation is the result of Explain. It can be rendered as text by
+// String, or as JSON by JSON.
+type DocExplanation struct {
+	DocID   int32 `json:"docID"`
+	Deleted bool  `json:"deleted,omitempty"`
+	Matched bool  `json:"matched"`
+	// The Query of the node eliminating the doc, e.g. the first unmatched
+	// sub-query of an And. It is empty if the doc matches.
+	EliminatedBy string       `json:"eliminatedBy,omitempty"`
+	Explanation  *Explanation `json:"explanation"`
+}
+
+// Explain explains why a doc matches q or not, with the containment, posting
+// list length and doc frequency of each node of q. ErrInvalidDocID is
+// returned if the doc does not exist. A deleted doc never matches, but its
+// explanation is still computed.
+func (s *TokenSetSearcher) Explain(q Query, docID int32) (*DocExplanation, error) {
+	if docID < 0 || int(docID) >= len(s.docs) {
+		return nil, ErrInvalidDocID
+	}
+	e, elim := s.explain(q, docID)
+	de := &DocExplanation{
+		DocID:       docID,
+		Deleted:     s.isDeleted(docID),
+		Matched:     e.Matched,
+		Explanation: e,
+	}
+	if de.Deleted {
+		de.Matched = false
+	}
+	if elim != nil {
+		de.EliminatedBy = elim.Query
+	}
+	return de, nil
+}
+
+// explain returns the Explanation of q for docID, and the node eliminating
+// the doc, nil if q matches.
+func (s *TokenSetSearcher) explain(q Query, docID int32) (e, elim *Explanation) {
+	switch q := q.(type) {
+	case Term:
+		e = s.explainTerm(q, docID)
+	case And:
+		e = &Explanation{Query: "AND", Matched: true}
+		for _, sub := range q {
+			c, subElim := s.explain(sub, docID)
+			e.Children = append(e.Children, c)
+			if !c.Matched && e.Matched {
+				e.Matched, elim = false, subElim
+			}
+		}
+	case Or:
+		e = &Explanation{Query: "OR"}
+		for _, sub := range q {
+			c, _ := s.explain(sub, docID)
+			e.Children = append(e.Children, c)
+			e.Matched = e.Matched || c.Matched
+		}
+	case Not:
+		c, _ := s.explain(q.Query, docID)
+		e = &Explanation{Query: "NOT", Matched: !c.Matched, Children: []*Explanation{c}}
+	case Phrase:
+		e, elim = s.explainTokens(q, fmt.Sprintf("%s:%q", q.Field, strings.Join(q.Tokens, " ")), q.Field, q.Tokens, docID)
+	case Near:
+		e, elim = s.explainTokens(q, fmt.Sprintf("%s:%q~%d", q.Field, strings.Join(q.Tokens, " "), q.Distance), q.Field, q.Tokens, docID)
+	default:
+		e = &Explanation{Query: queryString(q)}
+		e.Matched = containsDoc(q.docList(s), docID)
+	}
+	if _, ok := q.(Term); !ok {
+		e.DocFreq = len(s.liveDocs(q.docList(s)))
+	}
+	if !e.Matched && elim == nil {
+		elim = e
+	}
+	return e, elim
+}
+
+// explainTerm returns the Explanation of a Term.
+func (s *TokenSetSearcher) explainTerm(t Term, docID int32) *Explanation {
+	l := s.postings(t.Field, t.Token)
+	e := &Explanation{Query: t.Field + ":" + t.Token, PostingLen: l.len()}
+	it := l.iterator()
+	e.Matched = it.advance(docID) && it.docID() == docID
+	for it := l.iterator(); it.next(); {
+		if !s.isDeleted(it.docID()) {
+			e.DocFreq++
+		}
+	}
+	return e
+}
+
+// explainTokens returns the Explanation of a positional query with a Term
+// child for each token. The first unmatched Term eliminates the doc, or the
+// query itself if all Terms match.
+func (s *TokenSetSearcher) explainTokens(q Query, desc, field string, tokens []string, docID int32) (e, elim *Explanation) {
+	e = &Explanation{Query: desc, Matched: containsDoc(q.docList(s), docID)}
+	for _, token := range tokens {
+		c := s.explainTerm(Term{Field: field, Token: token}, docID)
+		e.Children = append(e.Children, c)
+		if !c.Matched && elim == nil {
+			elim = c
+		}
+	}
+	if e.Matched {
+		elim = nil
+	}
+	return e, elim
+}
+
+// queryString returns a leaf query in the query syntax of ParseQuery.
+func queryString(q Query) string {
+	switch q := q.(type) {
+	case Prefix:
+		return q.Field + ":" + q.Prefix + "*"
+	case Wildcard:
+		return q.Field + ":" + q.Pattern
+	case Fuzzy:
+		return fmt.Sprintf("%s:%s~%d", q.Field, q.Token, q.MaxDistance)
+	case IntRange:
+		return fmt.Sprintf("%s:[%d TO %d]", q.Field, q.Min, q.Max)
+	case FloatRange:
+		return fmt.Sprintf("%s:[%g TO %g]", q.Field, q.Min, q.Max)
+	}
+	return fmt.Sprintf("%v", q)
+}
+
+// containsDoc returns whether the sorted list contains docID.
+func containsDoc(list []int32, docID int32) bool {
+	i := sort.Search(len(list), func(i int) bool {
+		return list[i] >= docID
+	})
+	return i < len(list) && list[i] == docID
+}
+
+// String renders the explanation as an indented text tree.
+func (de *DocExplanation) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "doc %d: ", de.DocID)
+	switch {
+	case de.Deleted:
+		b.WriteString("deleted")
+	case de.Matched:
+		b.WriteString("matched")
+	default:
+		fmt.Fprintf(&b, "not matched, eliminated by %s", de.EliminatedBy)
+	}
+	b.WriteString("\n")
+	de.Explanation.write(&b, "")
+	return b.String()
+}
+
+func (e *Explanation) write(b *bytes.Buffer, indent string) {
+	matched := "matched"
+	if !e.Matched {
+		matched = "not matched"
+	}
+	if e.PostingLen > 0 {
+		fmt.Fprintf(b, "%s%s: %s (postings %d, df %d)\n", indent, e.Query, matched, e.PostingLen, e.DocFreq)
+	} else {
+		fmt.Fprintf(b, "%s%s: %s (df %d)\n", indent, e.Query, matched, e.DocFreq)
+	}
+	for _, c := range e.Children {
+		c.write(b, indent+"  ")
+	}
+}
+
+// JSON returns the explanation encoded as indented JSON.
+func (de *DocExplanation) JSON() ([]byte, error) {
+	return json.MarshalIndent(de, "", "  ")
+}
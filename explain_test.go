@@ -0,0 +1,77 @@
+package index
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTokenSetSearcher_Explain(t *testing.T) {
+	sch := indexDocs([][2]string{
+		{"0", "net http server"},
+		{"1", "gorilla mux http"},
+		{"2", "gorilla websocket deprecated"},
+		{"3", "net rpc"},
+	})
+	q := And{Term{"text", "http"}, Not{Term{"text", "deprecated"}}, Term{"text", "net"}}
+	e, err := sch.Explain(q, 1)
+	assert.NoErrorOrDie(t, err)
+	assert.False(t, "Matched", e.Matched)
+	assert.Equal(t, "EliminatedBy", e.EliminatedBy, "text:net")
+	assert.Equal(t, "String", e.String(), `doc 1: not matched, eliminated by text:net
+AND: not matched (df 1)
+  text:http: matched (postings 2, df 2)
+  NOT: matched (df 3)
+    text:deprecated: not matched (postings 1, df 1)
+  text:net: not matched (postings 2, df 2)
+`)
+
+	e, err = sch.Explain(q, 0)
+	assert.NoErrorOrDie(t, err)
+	assert.True(t, "Matched", e.Matched)
+	assert.Equal(t, "EliminatedBy", e.EliminatedBy, "")
+
+	e, err = sch.Explain(And{Term{"text", "gorilla"}, Not{Term{"text", "deprecated"}}}, 2)
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "EliminatedBy", e.EliminatedBy, "NOT")
+
+	e, err = sch.Explain(Or{Term{"text", "http"}, Prefix{Field: "text", Prefix: "rp"}}, 2)
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "EliminatedBy", e.EliminatedBy, "OR")
+	assert.Equal(t, "Query", e.Explanation.Children[1].Query, "text:rp*")
+	assert.Equal(t, "DocFreq", e.Explanation.Children[1].DocFreq, 1)
+
+	e, err = sch.Explain(Phrase{Field: "text", Tokens: []string{"gorilla", "http"}}, 2)
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "EliminatedBy", e.EliminatedBy, "text:http")
+
+	assert.NoError(t, sch.DeleteDoc(0))
+	e, err = sch.Explain(Term{"text", "http"}, 0)
+	assert.NoErrorOrDie(t, err)
+	assert.True(t, "Deleted", e.Deleted)
+	assert.False(t, "Matched", e.Matched)
+	assert.Equal(t, "PostingLen", e.Explanation.PostingLen, 2)
+	assert.Equal(t, "DocFreq", e.Explanation.DocFreq, 1)
+	assert.Equal(t, "String", e.String(), "doc 0: deleted\ntext:http: matched (postings 2, df 1)\n")
+
+	_, err = sch.Explain(q, 4)
+	assert.Equal(t, "err", err, ErrInvalidDocID)
+}
+
+func TestDocExplanation_JSON(t *testing.T) {
+	sch := indexDocs([][2]string{
+		{"0", "net http"},
+		{"1", "net rpc"},
+	})
+	e, err := sch.Explain(And{Term{"text", "net"}, Term{"text", "http"}}, 1)
+	assert.NoErrorOrDie(t, err)
+	bs, err := e.JSON()
+	assert.NoErrorOrDie(t, err)
+
+	var decoded DocExplanation
+	assert.NoErrorOrDie(t, json.Unmarshal(bs, &decoded))
+	assert.Equal(t, "decoded", &decoded, e)
+	assert.Equal(t, "EliminatedBy", decoded.EliminatedBy, "text:http")
+	assert.Equal(t, "children", len(decoded.Explanation.Children), 2)
+}
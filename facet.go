@@ -0,0 +1,50 @@
+package index
+
+import (
+	"sort"
+)
+
+// FacetCount is the number of hits containing a token of a facet field.
+type FacetCount struct {
+	Token string
+	Count int
+}
+
+// Facets returns, for each of fields, the number of documents matching q
+// containing each token of the field. Tokens with a zero count are omitted.
+// Counts of a field are sorted in descending order, and by tokens for a tie.
+// If topN > 0, at most topN counts are returned for each field.
+//
+// Counts are computed by intersecting the hits with the inverted lists of the
+// tokens, so the data of documents are not touched.
+func (s *TokenSetSearcher) Facets(q Query, fields []string, topN int) map[string][]FacetCount {
+	hits := s.liveDocs(q.docList(s))
+	facets := make(map[string][]FacetCount, len(fields))
+	for _, fld := range fields {
+		fi := s.field(fld)
+		var counts []FacetCount
+		fi.ascend("", func(token string) bool {
+			cnt := 0
+			if len(hits) > 0 {
+				intersectDocs([]docIterator{
+					newSliceIterator(hits), fi.inverted[token].iterator(),
+				}, func(int32) error {
+					cnt++
+					return nil
+				})
+			}
+			if cnt > 0 {
+				counts = append(counts, FacetCount{Token: token, Count: cnt})
+			}
+			return true
+		})
+		sort.SliceStable(counts, func(i, j int) bool {
+			return counts[i].Count > counts[j].Count
+		})
+		if topN > 0 && len(counts) > topN {
+			counts = counts[:topN]
+		}
+		facets[fld] = counts
+	}
+	return facets
+}
@@ -0,0 +1,53 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTokenSetSearcher_Facets(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	sch.AddDoc(map[string]stringsp.Set{
+		"text":    stringsp.NewSet("http"),
+		"license": stringsp.NewSet("bsd"),
+		"stars":   stringsp.NewSet(">100"),
+	}, 0)
+	sch.AddDoc(map[string]stringsp.Set{
+		"text":    stringsp.NewSet("http"),
+		"license": stringsp.NewSet("mit"),
+		"stars":   stringsp.NewSet(">100", ">1000"),
+	}, 1)
+	sch.AddDoc(map[string]stringsp.Set{
+		"text":    stringsp.NewSet("http"),
+		"license": stringsp.NewSet("mit"),
+	}, 2)
+	sch.AddDoc(map[string]stringsp.Set{
+		"text":    stringsp.NewSet("rpc"),
+		"license": stringsp.NewSet("apache"),
+	}, 3)
+
+	facets := sch.Facets(Term{"text", "http"}, []string{"license", "stars"}, 0)
+	assert.Equal(t, "license", facets["license"], []FacetCount{
+		{Token: "mit", Count: 2},
+		{Token: "bsd", Count: 1},
+	})
+	assert.Equal(t, "stars", facets["stars"], []FacetCount{
+		{Token: ">100", Count: 2},
+		{Token: ">1000", Count: 1},
+	})
+
+	facets = sch.Facets(And{}, []string{"license"}, 1)
+	assert.Equal(t, "license", facets["license"], []FacetCount{
+		{Token: "mit", Count: 2},
+	})
+
+	assert.NoError(t, sch.DeleteDoc(1))
+	facets = sch.Facets(Term{"text", "http"}, []string{"license", "missing"}, 0)
+	assert.Equal(t, "license", facets["license"], []FacetCount{
+		{Token: "bsd", Count: 1},
+		{Token: "mit", Count: 1},
+	})
+	assert.Equal(t, "missing", len(facets["missing"]), 0)
+}
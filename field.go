@@ -0,0 +1,234 @@
+package index
+
+import (
+	"strings"
+)
+
+// fieldIndex is the inverted index of a field. Tokens of different fields
+// are kept in different fieldIndexes, so arbitrary bytes of fields and tokens
+// never collide, and looking up a token allocates no key.
+type fieldIndex struct {
+	name string
+	// map from token to list of local IDs(indexes in docs field)
+	inverted map[string]*postingList
+	// sorted tokens of inverted
+	terms termDict
+	// map from token to positions of the token in each doc, parallel to the
+	// list in inverted. Missing trailing elements are nils. A nil element
+	// means the doc was added by AddDoc and the token appears once.
+	positions map[string][][]int32
+	// number of tokens of each doc in the field, indexed by local ID.
+	// Missing trailing elements are zeros.
+	lens []int32
+	// sum of lens
+	lenSum int64
+}
+
+// termKey identifies a token of a field by the interned field ID.
+type termKey struct {
+	field int32
+	token string
+}
+
+// field returns the index of a field, or nil if the field does not exist.
+func (s *TokenSetSearcher) field(name string) *fieldIndex {
+	id, ok := s.fieldIDs[name]
+	if !ok {
+		return nil
+	}
+	return s.fields[id]
+}
+
+// internField returns the ID of a field, adding the field if not existing.
+func (s *TokenSetSearcher) internField(name string) int32 {
+	if id, ok := s.fieldIDs[name]; ok {
+		return id
+	}
+	if s.fieldIDs == nil {
+		s.fieldIDs = make(map[string]int32)
+	}
+	id := int32(len(s.fields))
+	s.fields = append(s.fields, &fieldIndex{
+		name:     name,
+		inverted: make(map[string]*postingList),
+	})
+	s.fieldIDs[name] = id
+	return id
+}
+
+// postings returns the inverted list of a token in a field, or nil if not
+// existing.
+func (s *TokenSetSearcher) postings(field, token string) *postingList {
+	return s.field(field).postings(token)
+}
+
+// docFreq returns the number of docs containing token in field.
+func (s *TokenSetSearcher) docFreq(field, token string) int {
+	return s.postings(field, token).len()
+}
+
+// addPosting appends docID to the inverted list of a token in the field of
+// id, and returns its index in the list.
+func (s *TokenSetSearcher) addPosting(id int32, token string, docID int32) int {
+	fi := s.fields[id]
+	l := fi.inverted[token]
+	if l == nil {
+		l = &postingList{}
+		fi.inverted[token] = l
+		fi.terms.add(token)
+	}
+	l.append(docID)
+	if s.cache != nil {
+		s.cache.invalidate(termKey{field: id, token: token})
+	}
+	return l.n - 1
+}
+
+// importKeys adds inverted lists keyed by "field:token", the format saved by
+// older versions, where the field is the part before the first ':'. Keys
+// without a ':' could never be queried, and are dropped.
+func (s *TokenSetSearcher) importKeys(inverted map[string]*postingList) {
+	for key, l := range inverted {
+		p := strings.Index(key, ":")
+		if p < 0 {
+			continue
+		}
+		fi := s.fields[s.internField(key[:p])]
+		fi.inverted[key[p+1:]] = l
+	}
+}
+
+// postings returns the inverted list of a token, or nil if not existing. It
+// is safe for a nil fieldIndex.
+func (fi *fieldIndex) postings(token string) *postingList {
+	if fi == nil {
+		return nil
+	}
+	return fi.inverted[token]
+}
+
+// ascend calls f with tokens not less than from in increasing order, until f
+// returns false. It is safe for a nil fieldIndex.
+func (fi *fieldIndex) ascend(from string, f func(token string) bool) {
+	if fi == nil {
+		return
+	}
+	fi.terms.ascend(from, f)
+}
+
+// addTokenPositions appends the positions of a token in the doc at index idx
+// of its inverted list.
+func (fi *fieldIndex) addTokenPositions(token string, idx int, pos []int32) {
+	if fi.positions == nil {
+		fi.positions = make(map[string][][]int32)
+	}
+	poss := fi.positions[token]
+	for len(poss) < idx {
+		poss = append(poss, nil)
+	}
+	fi.positions[token] = append(poss, pos)
+}
+
+// tokenPositions returns the positions of a token in the idx-th doc of its
+// inverted list, or nil if the positions are not indexed.
+func (fi *fieldIndex) tokenPositions(token string, idx int) []int32 {
+	if fi == nil {
+		return nil
+	}
+	poss := fi.positions[token]
+	if idx >= len(poss) {
+		return nil
+	}
+	return poss[idx]
+}
+
+// termFreq returns the frequency of a token in the idx-th doc of its
+// inverted list.
+func (fi *fieldIndex) termFreq(token string, idx int) int {
+	if pos := fi.tokenPositions(token, idx); len(pos) > 0 {
+		return len(pos)
+	}
+	return 1
+}
+
+// addLen adds n to the length of the field of the doc.
+func (fi *fieldIndex) addLen(docID int32, n int) {
+	if n == 0 {
+		return
+	}
+	for int32(len(fi.lens)) <= docID {
+		fi.lens = append(fi.lens, 0)
+	}
+	fi.lens[docID] += int32(n)
+	fi.lenSum += int64(n)
+}
+
+// docLen returns the length of the field of the doc. It is safe for a nil
+// fieldIndex.
+func (fi *fieldIndex) docLen(docID int32) int32 {
+	if fi == nil || docID >= int32(len(fi.lens)) {
+		return 0
+	}
+	return fi.lens[docID]
+}
+
+// rebuildTerms rebuilds the term dictionary from tokens of inverted.
+func (fi *fieldIndex) rebuildTerms() {
+	tokens := make([]string, 0, len(fi.inverted))
+	for token := range fi.inverted {
+		tokens = append(tokens, token)
+	}
+	fi.terms = newTermDict(tokens)
+}
+
+// rebuildLens rebuilds lens from the inverted lists.
+func (fi *fieldIndex) rebuildLens() {
+	fi.lens, fi.lenSum = nil, 0
+	for token, l := range fi.inverted {
+		for it := l.iterator(); it.next(); {
+			fi.addLen(it.docID(), fi.termFreq(token, it.idx))
+		}
+	}
+}
+
+// compact removes deleted docs, where newIDs is the mapping returned by
+// Compact.
+func (fi *fieldIndex) compact(newIDs []int32) {
+	for token, l := range fi.inverted {
+		poss := fi.positions[token]
+		newL := &postingList{}
+		var newPoss [][]int32
+		for it := l.iterator(); it.next(); {
+			docID := it.docID()
+			if newIDs[docID] < 0 {
+				continue
+			}
+			if it.idx < len(poss) {
+				for len(newPoss) < newL.n {
+					newPoss = append(newPoss, nil)
+				}
+				newPoss = append(newPoss, poss[it.idx])
+			}
+			newL.append(newIDs[docID])
+		}
+		if newL.n == 0 {
+			delete(fi.inverted, token)
+			delete(fi.positions, token)
+			continue
+		}
+		fi.inverted[token] = newL
+		if poss != nil {
+			fi.positions[token] = newPoss
+		}
+	}
+	fi.rebuildTerms()
+	newLens := fi.lens[:0]
+	var sum int64
+	for docID, l := range fi.lens {
+		if newIDs[docID] >= 0 {
+			newLens = append(newLens, l)
+			sum += int64(l)
+		}
+	}
+	fi.lens, fi.lenSum = newLens, sum
+}
@@ -0,0 +1,52 @@
+package index
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTokenSetSearcher_FieldsNoCollision(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	// "a" + ":" + "b:c" == "a:b" + ":" + "c"
+	sch.AddDoc(map[string]stringsp.Set{"a": stringsp.NewSet("b:c")}, 0)
+	sch.AddDoc(map[string]stringsp.Set{"a:b": stringsp.NewSet("c")}, 1)
+	sch.AddDocTokens(map[string][]string{"": {":", "x\x00y"}}, 2)
+
+	check := func(sch *TokenSetSearcher) {
+		assert.StringEqual(t, "a", sch.TokenDocList("a", "b:c"), "[0]")
+		assert.StringEqual(t, "a:b", sch.TokenDocList("a:b", "c"), "[1]")
+		assert.StringEqual(t, "empty", sch.TokenDocList("", ":"), "[2]")
+		assert.StringEqual(t, "empty", sch.TokenDocList("", "x\x00y"), "[2]")
+		assert.StringEqual(t, "a:b:c", sch.TokenDocList("a:b:c", ""), "[]")
+		assert.StringEqual(t, "a b:c", searchDocs(t, sch, SingleFieldQuery("a", "b:c")), "[0]")
+		assert.StringEqual(t, "a:b c", searchQueryDocs(t, sch, And{Term{"a:b", "c"}, Term{"a:b", "c"}}), "[1]")
+		assert.StringEqual(t, "prefix", sch.ExpandPrefix("a", "", 0), "[b:c]")
+		assert.StringEqual(t, "phrase", searchQueryDocs(t, sch, Phrase{"", []string{":", "x\x00y"}}), "[2]")
+	}
+	check(sch)
+
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	var loaded TokenSetSearcher
+	assert.NoErrorOrDie(t, loaded.Load(bytes.NewReader(b)))
+	check(&loaded)
+
+	dir := path.Join(os.TempDir(), "TestTokenSetSearcher_FieldsNoCollision")
+	assert.NoErrorOrDie(t, os.RemoveAll(dir))
+	assert.NoErrorOrDie(t, sch.SaveToDir(dir))
+	ds, err := OpenDiskTokenSetSearcher(dir)
+	assert.NoErrorOrDie(t, err)
+	defer ds.Close()
+	docs, err := ds.TokenDocList("a", "b:c")
+	assert.NoError(t, err)
+	assert.StringEqual(t, "a", docs, "[0]")
+	docs, err = ds.TokenDocList("a:b", "c")
+	assert.NoError(t, err)
+	assert.StringEqual(t, "a:b", docs, "[1]")
+}
@@ -0,0 +1,138 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Saved data starts with a header of magic bytes followed by the format
+// version as a big-endian uint32. The header is followed by sections, each of
+// which is the big-endian uint64 length of a standalone gob stream, the
+// stream, and the big-endian CRC32 (IEEE) of the stream.
+const (
+	searcherMagic = "GOIDXTSS"
+	indexerMagic  = "GOIDXTIX"
+
+	// current format versions
+	searcherFormatVersion = 1
+	indexerFormatVersion  = 1
+)
+
+var (
+	// error of a section whose checksum does not match its content
+	ErrChecksumMismatch = errors.New("Checksum mismatch")
+	// error of data saved with a format version not supported
+	ErrUnsupportedVersion = errors.New("Unsupported format version")
+)
+
+// writeHeader writes magic and version to w.
+func writeHeader(w io.Writer, magic string, version uint32) error {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], version)
+	if _, err := io.WriteString(w, magic); err != nil {
+		return err
+	}
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// readHeader reads the header with magic from r. If r does not start with
+// magic, nothing is consumed and ok is false, i.e. the data were saved in the
+// headerless format.
+func readHeader(r *bufio.Reader, magic string) (version uint32, ok bool, err error) {
+	bs, err := r.Peek(len(magic))
+	if err != nil || string(bs) != magic {
+		// headerless data, or too short to tell, which the legacy decoder
+		// reports.
+		return 0, false, nil
+	}
+	r.Discard(len(magic))
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, true, unexpectedEOF(err)
+	}
+	return binary.BigEndian.Uint32(buf[:]), true, nil
+}
+
+// writeSection calls encode with a new gob encoder, and writes the encoded
+// bytes as a section, i.e. the big-endian uint64 length of the bytes, the
+// bytes, and the big-endian CRC32 of the bytes.
+func writeSection(w io.Writer, encode func(enc *gob.Encoder) error) error {
+	var payload bytes.Buffer
+	if err := encode(gob.NewEncoder(&payload)); err != nil {
+		return err
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(payload.Len()))
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	crc := crc32.ChecksumIEEE(payload.Bytes())
+	if _, err := payload.WriteTo(w); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(buf[:4], crc)
+	_, err := w.Write(buf[:4])
+	return err
+}
+
+// readSection reads a section written by writeSection, verifies its checksum,
+// and only then calls decode with a gob decoder reading the verified bytes. A
+// section ending early is reported as io.ErrUnexpectedEOF.
+func readSection(r *bufio.Reader, decode func(dec *gob.Decoder) error) error {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	n := binary.BigEndian.Uint64(buf[:])
+	if n > math.MaxInt64 {
+		// more than any data can have
+		return io.ErrUnexpectedEOF
+	}
+	// The payload buffer grows with the bytes actually read, so a corrupted
+	// length cannot allocate more memory than the data.
+	var payload bytes.Buffer
+	if _, err := io.CopyN(&payload, r, int64(n)); err != nil {
+		return unexpectedEOF(err)
+	}
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		return unexpectedEOF(err)
+	}
+	if binary.BigEndian.Uint32(buf[:4]) != crc32.ChecksumIEEE(payload.Bytes()) {
+		return ErrChecksumMismatch
+	}
+	return unexpectedEOF(decode(gob.NewDecoder(bytes.NewReader(payload.Bytes()))))
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// encodeDoc encodes the data of a doc as a standalone gob stream, so that it
+// can be decoded independently.
+func encodeDoc(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeDoc decodes the data of a doc encoded by encodeDoc.
+func decodeDoc(bs []byte) (interface{}, error) {
+	var data interface{}
+	if err := gob.NewDecoder(bytes.NewReader(bs)).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
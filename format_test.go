@@ -0,0 +1,135 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func formatTestSearcher() *TokenSetSearcher {
+	sch := &TokenSetSearcher{}
+	sch.AddDocTokens(map[string][]string{
+		"text": {"go", "http", "server"},
+	}, "doc-data-0")
+	sch.AddDoc(SingleFieldQuery("text", "go", "rpc"), "doc-data-1")
+	sch.AddDoc(SingleFieldQuery("text", "http"), "doc-data-2")
+	sch.DeleteDoc(2)
+	return sch
+}
+
+func TestTokenSetSearcher_SaveFormat(t *testing.T) {
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, formatTestSearcher().Save(&b))
+	assert.Equal(t, "magic", string(b[:len(searcherMagic)]), searcherMagic)
+
+	var sch TokenSetSearcher
+	assert.NoErrorOrDie(t, sch.Load(bytes.NewReader(b)))
+	assert.Equal(t, "DocCount", sch.DocCount(), 2)
+	assert.StringEqual(t, "go", sch.TokenDocList("text", "go"), "[0 1]")
+	assert.StringEqual(t, "phrase", searchQueryDocs(t, &sch,
+		Phrase{"text", []string{"http", "server"}}), "[0]")
+	assert.Equal(t, "data", sch.DocInfo(1), "doc-data-1")
+
+	// a corrupted byte in the data of a doc
+	p := bytes.Index(b, []byte("doc-data-1"))
+	assert.ValueShould(t, "p", p, p > 0, "not found")
+	corrupted := append([]byte(nil), b...)
+	corrupted[p] ^= 0xff
+	assert.Equal(t, "err", sch.Load(bytes.NewReader(corrupted)), ErrChecksumMismatch)
+
+	// Any corrupted byte of a section, including the message lengths and type
+	// definitions of gob at the start of the payload, is detected by the
+	// checksum before decoding.
+	sections := 0
+	for p := len(searcherMagic) + 4; p < len(b); sections++ {
+		n := int(binary.BigEndian.Uint64(b[p:]))
+		for i := p; i < p+8+n+4; i++ {
+			corrupted := append([]byte(nil), b...)
+			corrupted[i] ^= 0xff
+			err := sch.Load(bytes.NewReader(corrupted))
+			if i < p+8 {
+				// a corrupted length of the section
+				assert.ValueShould(t, "err", err, err != nil, "should fail for a corrupted length")
+			} else {
+				assert.Equal(t, "err", err, ErrChecksumMismatch)
+			}
+		}
+		p += 8 + n + 4
+	}
+	assert.Equal(t, "sections", sections, 6)
+
+	// truncated data
+	for l := len(searcherMagic); l < len(b); l++ {
+		err := sch.Load(bytes.NewReader(b[:l]))
+		assert.ValueShould(t, "err", err, err != nil, "should fail for truncated data")
+	}
+	assert.Equal(t, "err", sch.Load(bytes.NewReader(b[:len(b)-2])), io.ErrUnexpectedEOF)
+
+	// an unsupported version
+	newer := append([]byte(nil), b...)
+	newer[len(searcherMagic)+3]++
+	assert.Equal(t, "err", sch.Load(bytes.NewReader(newer)), ErrUnsupportedVersion)
+}
+
+func TestTokenSetSearcher_LoadHeaderless(t *testing.T) {
+	// the format saved before the header was introduced
+	var b bytesp.Slice
+	enc := gob.NewEncoder(&b)
+	assert.NoErrorOrDie(t, enc.Encode(2))
+	for _, data := range []interface{}{"a", "b"} {
+		assert.NoErrorOrDie(t, enc.Encode(&data))
+	}
+	assert.NoErrorOrDie(t, enc.Encode(2))
+	assert.NoErrorOrDie(t, enc.Encode("text:go"))
+	assert.NoErrorOrDie(t, enc.Encode([]int32{0, 1}))
+	assert.NoErrorOrDie(t, enc.Encode("url:a:b"))
+	assert.NoErrorOrDie(t, enc.Encode([]int32{1}))
+
+	var sch TokenSetSearcher
+	assert.NoErrorOrDie(t, sch.Load(&b))
+	assert.Equal(t, "DocCount", sch.DocCount(), 2)
+	assert.StringEqual(t, "go", sch.TokenDocList("text", "go"), "[0 1]")
+	assert.StringEqual(t, "url", sch.TokenDocList("url", "a:b"), "[1]")
+	assert.Equal(t, "postings", sch.TokenPostings("text", "go"), []Posting{
+		{DocID: 0, Freq: 1},
+		{DocID: 1, Freq: 1},
+	})
+
+	// migrated to the current format by saving again
+	b = nil
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.Equal(t, "magic", string(b[:len(searcherMagic)]), searcherMagic)
+	assert.NoErrorOrDie(t, sch.Load(&b))
+	assert.Equal(t, "DocCount", sch.DocCount(), 2)
+	assert.StringEqual(t, "go", sch.TokenDocList("text", "go"), "[0 1]")
+	assert.StringEqual(t, "url", sch.TokenDocList("url", "a:b"), "[1]")
+}
+
+func TestTokenIndexer_SaveFormat(t *testing.T) {
+	ti := &TokenIndexer{}
+	ti.PutTokens("a", stringsp.NewSet("b", "c"))
+
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, ti.Save(&b))
+	assert.Equal(t, "magic", string(b[:len(indexerMagic)]), indexerMagic)
+
+	corrupted := append([]byte(nil), b...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	assert.Equal(t, "err", ti.Load(bytes.NewReader(corrupted)), ErrChecksumMismatch)
+	assert.Equal(t, "err", ti.Load(bytes.NewReader(b[:len(b)-1])), io.ErrUnexpectedEOF)
+
+	// headerless
+	b = nil
+	enc := gob.NewEncoder(&b)
+	assert.NoErrorOrDie(t, enc.Encode(map[string][]string{"a": {"b"}}))
+	assert.NoErrorOrDie(t, enc.Encode(map[string][]string{"b": {"a"}}))
+	assert.NoErrorOrDie(t, ti.Load(&b))
+	assert.Equal(t, "ids of b", ti.IdsOfToken("b"), []string{"a"})
+	assert.Equal(t, "tokens of a", ti.TokensOfId("a"), []string{"b"})
+}
@@ -0,0 +1,126 @@
+package index
+
+import (
+	"sort"
+)
+
+// Fuzzy matches documents containing any token in Field within a Levenshtein
+// distance of MaxDistance (usually 1 or 2) from Token. MaxExpansions has the
+// same meaning as in Prefix.
+type Fuzzy struct {
+	Field         string
+	Token         string
+	MaxDistance   int
+	MaxExpansions int
+}
+
+func (q Fuzzy) docList(s *TokenSetSearcher) []int32 {
+	fts := s.FuzzyTokens(q.Field, q.Token, q.MaxDistance, maxExpansions(q.MaxExpansions))
+	tokens := make([]string, len(fts))
+	for i, ft := range fts {
+		tokens[i] = ft.Token
+	}
+	return s.unionTokens(q.Field, tokens)
+}
+
+// FuzzyToken is a token returned by FuzzyTokens.
+type FuzzyToken struct {
+	Token string
+	// Distance is the Levenshtein distance (in runes) to the queried token.
+	Distance int
+	// DocFreq is the number of documents containing the token.
+	DocFreq int
+}
+
+// FuzzyTokens returns at most max (unlimited if max <= 0) tokens in field
+// within a Levenshtein distance of maxDist from token. The tokens are sorted
+// by distance, then by document frequency in descending order, then by the
+// token.
+func (s *TokenSetSearcher) FuzzyTokens(field, token string, maxDist, max int) []FuzzyToken {
+	fi := s.field(field)
+	target := []rune(token)
+	var res []FuzzyToken
+	// rows[i] is the row of the edit-distance matrix for the first i runes of
+	// last
+	rows := [][]int{make([]int, len(target)+1)}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	var last []rune
+	// rows of a prefix longer than dead cannot be within maxDist
+	dead := -1
+	fi.ascend("", func(token string) bool {
+		cur := []rune(token)
+		cp := 0
+		for cp < len(cur) && cp < len(last) && cur[cp] == last[cp] {
+			cp++
+		}
+		last = cur
+		if dead >= 0 && cp >= dead {
+			return true
+		}
+		dead = -1
+		rows = rows[:cp+1]
+		for i := cp; i < len(cur); i++ {
+			prev, row := rows[i], make([]int, len(target)+1)
+			row[0] = i + 1
+			mn := row[0]
+			for j := 1; j <= len(target); j++ {
+				cost := 1
+				if cur[i] == target[j-1] {
+					cost = 0
+				}
+				row[j] = minInt(minInt(prev[j]+1, row[j-1]+1), prev[j-1]+cost)
+				mn = minInt(mn, row[j])
+			}
+			rows = append(rows, row)
+			if mn > maxDist {
+				dead = i + 1
+				return true
+			}
+		}
+		if d := rows[len(cur)][len(target)]; d <= maxDist {
+			res = append(res, FuzzyToken{
+				Token:    token,
+				Distance: d,
+				DocFreq:  fi.postings(token).len(),
+			})
+		}
+		return true
+	})
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if a.DocFreq != b.DocFreq {
+			return a.DocFreq > b.DocFreq
+		}
+		return a.Token < b.Token
+	})
+	if max > 0 && len(res) > max {
+		res = res[:max]
+	}
+	return res
+}
+
+// Suggest returns a "did you mean" replacement of token in field. Among the
+// tokens within maxDist and more frequent than token itself, the closest one
+// is returned, with the highest document frequency if there is a tie. ok is
+// false if no such token exists.
+func (s *TokenSetSearcher) Suggest(field, token string, maxDist int) (suggestion string, ok bool) {
+	df := s.docFreq(field, token)
+	for _, ft := range s.FuzzyTokens(field, token, maxDist, 0) {
+		if ft.Distance > 0 && ft.DocFreq > df {
+			return ft.Token, true
+		}
+	}
+	return "", false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,50 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTokenSetSearcher_FuzzyTokens(t *testing.T) {
+	sch := indexDocs([][2]string{
+		{"0", "gorilla protobuf"},
+		{"1", "gorilla mux"},
+		{"2", "gorila protobuff"},
+		{"3", "godoc gorm"},
+	})
+
+	assert.Equal(t, "gorila", sch.FuzzyTokens("text", "gorila", 1, 0), []FuzzyToken{
+		{Token: "gorila", Distance: 0, DocFreq: 1},
+		{Token: "gorilla", Distance: 1, DocFreq: 2},
+	})
+	assert.Equal(t, "gorila max 1", sch.FuzzyTokens("text", "gorila", 1, 1), []FuzzyToken{
+		{Token: "gorila", Distance: 0, DocFreq: 1},
+	})
+	assert.Equal(t, "protobuff", sch.FuzzyTokens("text", "protobuff", 2, 0), []FuzzyToken{
+		{Token: "protobuff", Distance: 0, DocFreq: 1},
+		{Token: "protobuf", Distance: 1, DocFreq: 1},
+	})
+	assert.Equal(t, "gor", sch.FuzzyTokens("text", "gor", 1, 0), []FuzzyToken{
+		{Token: "gorm", Distance: 1, DocFreq: 1},
+	})
+	assert.Equal(t, "xyz", len(sch.FuzzyTokens("text", "xyz", 1, 0)), 0)
+
+	assert.StringEqual(t, "gorila~1", searchQueryDocs(t, sch,
+		Fuzzy{Field: "text", Token: "gorila", MaxDistance: 1}), "[0 1 2]")
+
+	sug, ok := sch.Suggest("text", "gorila", 2)
+	assert.True(t, "ok", ok)
+	assert.Equal(t, "suggestion", sug, "gorilla")
+	_, ok = sch.Suggest("text", "gorilla", 2)
+	assert.False(t, "ok", ok)
+
+	// tokens of invalid UTF-8 are returned as they are indexed
+	sch.AddDocTokens(map[string][]string{"text": {"mu\xffx"}}, "4")
+	assert.Equal(t, "mux~1", sch.FuzzyTokens("text", "mux", 1, 0), []FuzzyToken{
+		{Token: "mux", Distance: 0, DocFreq: 1},
+		{Token: "mu\xffx", Distance: 1, DocFreq: 1},
+	})
+	assert.StringEqual(t, "mux~1 docs", searchQueryDocs(t, sch,
+		Fuzzy{Field: "text", Token: "mux", MaxDistance: 1}), "[1 4]")
+}
@@ -0,0 +1,117 @@
+package index
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// error of a count in saved data exceeding the limit of LoadOptions, or
+	// being negative
+	ErrLimitExceeded = errors.New("Count out of the limit")
+)
+
+// LoadOptions are options for TokenSetSearcher.LoadWithOptions.
+type LoadOptions struct {
+	// Maximum number of docs. Zero means no limit.
+	MaxDocs int
+	// Maximum number of terms, i.e. field:token pairs, of the inverted lists
+	// and of the positions respectively. Zero means no limit.
+	MaxTerms int
+	// If true, the data of docs are kept encoded and decoded each time they
+	// are returned by DocInfo or searching. Only data saved with a header can
+	// be loaded lazily, data saved by older versions are decoded eagerly.
+	LazyDocs bool
+	// If not nil, Progress is called periodically while loading, and at the
+	// end of each section.
+	Progress func(p LoadProgress)
+}
+
+// LoadProgress is the progress of loading reported to LoadOptions.Progress.
+type LoadProgress struct {
+	// The section being loaded: "docs", "inverted", "positions", "deleted",
+	// "numbers" or "columns".
+	Section string
+	// Number of loaded items and the total number of items in the section.
+	Loaded, Total int
+	// Number of bytes read from the Reader so far.
+	Bytes int64
+}
+
+const (
+	// the maximum capacity allocated in advance for an untrusted count
+	maxPrealloc = 1 << 16
+	// number of items loaded between two progress reports
+	progressInterval = 4096
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// loader keeps the state of a loading.
+type loader struct {
+	opts LoadOptions
+	cr   *countingReader
+}
+
+// checkCount returns ErrLimitExceeded if n is negative or larger than a
+// positive max.
+func checkCount(n, max int) error {
+	if n < 0 || max > 0 && n > max {
+		return ErrLimitExceeded
+	}
+	return nil
+}
+
+// preallocLen returns the capacity to allocate in advance for n items.
+func preallocLen(n int) int {
+	if n > maxPrealloc {
+		return maxPrealloc
+	}
+	return n
+}
+
+// progress reports the progress in the middle of a section if loaded is a
+// multiple of progressInterval.
+func (ld *loader) progress(section string, loaded, total int) {
+	if loaded%progressInterval == 0 && loaded < total {
+		ld.report(section, loaded, total)
+	}
+}
+
+// done reports the end of a section.
+func (ld *loader) done(section string, total int) {
+	ld.report(section, total, total)
+}
+
+func (ld *loader) report(section string, loaded, total int) {
+	if ld.opts.Progress == nil {
+		return
+	}
+	ld.opts.Progress(LoadProgress{
+		Section: section,
+		Loaded:  loaded,
+		Total:   total,
+		Bytes:   ld.cr.n,
+	})
+}
+
+// lazyDoc is the gob-encoded data of a doc loaded with LoadOptions.LazyDocs.
+type lazyDoc []byte
+
+// doc returns the data of a doc, decoding it if it was loaded lazily.
+func (s *TokenSetSearcher) doc(docID int32) (interface{}, error) {
+	if bs, ok := s.docs[docID].(lazyDoc); ok {
+		return decodeDoc(bs)
+	}
+	return s.docs[docID], nil
+}
@@ -0,0 +1,138 @@
+package index
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTokenSetSearcher_LoadWithOptions_Limits(t *testing.T) {
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, formatTestSearcher().Save(&b))
+
+	var sch TokenSetSearcher
+	assert.Equal(t, "err", sch.LoadWithOptions(bytes.NewReader(b), LoadOptions{
+		MaxDocs: 2,
+	}), ErrLimitExceeded)
+	assert.Equal(t, "err", sch.LoadWithOptions(bytes.NewReader(b), LoadOptions{
+		MaxTerms: 3,
+	}), ErrLimitExceeded)
+	assert.NoError(t, sch.LoadWithOptions(bytes.NewReader(b), LoadOptions{
+		MaxDocs:  3,
+		MaxTerms: 4,
+	}))
+	assert.Equal(t, "DocCount", sch.DocCount(), 2)
+
+	// a huge count in headerless data
+	b = nil
+	enc := gob.NewEncoder(&b)
+	assert.NoErrorOrDie(t, enc.Encode(1<<40))
+	data := interface{}("a")
+	assert.NoErrorOrDie(t, enc.Encode(&data))
+	err := sch.Load(bytes.NewReader(b))
+	assert.ValueShould(t, "err", err, err != nil, "should fail for missing docs")
+	assert.Equal(t, "err", sch.LoadWithOptions(bytes.NewReader(b), LoadOptions{
+		MaxDocs: 1000,
+	}), ErrLimitExceeded)
+}
+
+func TestTokenSetSearcher_Load_InvalidDocID(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	sch.AddDocTokens(map[string][]string{"text": {"a"}}, 0)
+	sch.AddDocTokens(map[string][]string{"text": {"b"}}, 1)
+	sch.AddDocTokens(map[string][]string{"text": {"b"}}, 2)
+	// an inverted list referring to a doc not saved
+	sch.docs = sch.docs[:2]
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.Equal(t, "err", sch.Load(bytes.NewReader(b)), ErrInvalidDocID)
+
+	// docIDs out of order
+	sch = &TokenSetSearcher{}
+	for i := 0; i < 3; i++ {
+		sch.AddDocTokens(map[string][]string{"text": {"a"}}, i)
+	}
+	sch.field("text").inverted["a"] = &postingList{data: []byte{2, 0, 0}, n: 3}
+	b = nil
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.Equal(t, "err", sch.Load(bytes.NewReader(b)), ErrInvalidDocID)
+
+	// an empty inverted list
+	sch = &TokenSetSearcher{}
+	sch.AddDocTokens(map[string][]string{"text": {"a"}}, 0)
+	sch.field("text").inverted["b"] = newPostingList(nil)
+	b = nil
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.Equal(t, "err", sch.Load(bytes.NewReader(b)), ErrLimitExceeded)
+}
+
+func TestTokenSetSearcher_LoadWithOptions_LazyDocs(t *testing.T) {
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, formatTestSearcher().Save(&b))
+
+	var sch TokenSetSearcher
+	assert.NoErrorOrDie(t, sch.LoadWithOptions(bytes.NewReader(b), LoadOptions{
+		LazyDocs: true,
+	}))
+	_, lazy := sch.docs[0].(lazyDoc)
+	assert.True(t, "lazy", lazy)
+	assert.Equal(t, "data", sch.DocInfo(1), "doc-data-1")
+
+	var docs []interface{}
+	assert.NoError(t, sch.Search(SingleFieldQuery("text", "go"), func(docID int32, data interface{}) error {
+		docs = append(docs, data)
+		return nil
+	}))
+	assert.Equal(t, "docs", docs, []interface{}{"doc-data-0", "doc-data-1"})
+
+	// saving lazy docs without decoding
+	var b2 bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b2))
+	assert.NoErrorOrDie(t, sch.Load(&b2))
+	_, lazy = sch.docs[0].(lazyDoc)
+	assert.False(t, "lazy", lazy)
+	assert.Equal(t, "data", sch.DocInfo(0), "doc-data-0")
+
+	// headerless data are decoded eagerly
+	b = nil
+	enc := gob.NewEncoder(&b)
+	assert.NoErrorOrDie(t, enc.Encode(1))
+	data := interface{}("a")
+	assert.NoErrorOrDie(t, enc.Encode(&data))
+	assert.NoErrorOrDie(t, enc.Encode(0))
+	assert.NoErrorOrDie(t, sch.LoadWithOptions(&b, LoadOptions{LazyDocs: true}))
+	assert.Equal(t, "data", sch.docs[0], "a")
+}
+
+func TestTokenSetSearcher_LoadWithOptions_Progress(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	for i := 0; i < progressInterval+10; i++ {
+		sch.AddDoc(map[string]stringsp.Set{"text": stringsp.NewSet("go")}, i)
+	}
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+
+	var ps []LoadProgress
+	assert.NoErrorOrDie(t, sch.LoadWithOptions(bytes.NewReader(b), LoadOptions{
+		Progress: func(p LoadProgress) {
+			ps = append(ps, p)
+		},
+	}))
+	assert.Equal(t, "len(ps)", len(ps), 7)
+	assert.Equal(t, "ps[0]", ps[0].Loaded, progressInterval)
+	assert.Equal(t, "ps[1]", ps[1].Loaded, progressInterval+10)
+	assert.Equal(t, "ps[1]", ps[1].Total, progressInterval+10)
+	assert.Equal(t, "ps[2]", ps[2].Section, "inverted")
+	assert.Equal(t, "ps[3]", ps[3].Section, "positions")
+	assert.Equal(t, "ps[4]", ps[4].Section, "deleted")
+	assert.Equal(t, "ps[5]", ps[5].Section, "numbers")
+	assert.Equal(t, "ps[6]", ps[6].Section, "columns")
+	for i := 1; i < len(ps); i++ {
+		assert.ValueShould(t, "Bytes", ps[i].Bytes, ps[i].Bytes >= ps[i-1].Bytes, "should not decrease")
+	}
+	assert.Equal(t, "Bytes", ps[len(ps)-1].Bytes, int64(len(b)))
+}
@@ -0,0 +1,293 @@
+package index
+
+import (
+	"math"
+	"sort"
+
+	"github.com/golangplus/strings"
+)
+
+// NumericFields are the numeric values of a document, indexed for range
+// queries.
+//
+// A field should be consistently int or float. Values of the other kind are
+// converted to the kind of the first value of the field.
+type NumericFields struct {
+	Ints   map[string]int64
+	Floats map[string]float64
+}
+
+// numEntry is an entry of a numericIndex.
+type numEntry struct {
+	key   uint64
+	docID int32
+}
+
+func lessNumEntry(a, b numEntry) bool {
+	return a.key < b.key || a.key == b.key && a.docID < b.docID
+}
+
+// numericIndex is the index of a numeric field. Values are stored as keys
+// whose unsigned order is the same as the numeric order of the values.
+type numericIndex struct {
+	isFloat bool
+	// keys of docs indexed by local ID, valid if has is true. Missing
+	// trailing elements are invalid.
+	keys []uint64
+	has  []bool
+	// entries sorted by keys, then by docIDs
+	sorted []numEntry
+	// recently added entries, sorted. They are merged into sorted when there
+	// are too many of them.
+	pending []numEntry
+}
+
+// intKey returns the key of an int value.
+func intKey(v int64) uint64 {
+	return uint64(v) ^ 1<<63
+}
+
+// floatKey returns the key of a float value. NaNs are ordered out of the
+// range of infinities.
+func floatKey(v float64) uint64 {
+	if v == 0 {
+		// -0 is the same as 0
+		v = 0
+	}
+	b := math.Float64bits(v)
+	if b>>63 == 1 {
+		return ^b
+	}
+	return b | 1<<63
+}
+
+func keyInt(key uint64) int64 {
+	return int64(key ^ 1<<63)
+}
+
+func keyFloat(key uint64) float64 {
+	if key>>63 == 1 {
+		return math.Float64frombits(key &^ (1 << 63))
+	}
+	return math.Float64frombits(^key)
+}
+
+// add sets the key of a doc. It is ignored if the doc has a value.
+func (idx *numericIndex) add(docID int32, key uint64) {
+	if _, ok := idx.key(docID); ok {
+		return
+	}
+	for len(idx.keys) <= int(docID) {
+		idx.keys, idx.has = append(idx.keys, 0), append(idx.has, false)
+	}
+	idx.keys[docID], idx.has[docID] = key, true
+
+	e := numEntry{key: key, docID: docID}
+	i := sort.Search(len(idx.pending), func(i int) bool {
+		return !lessNumEntry(idx.pending[i], e)
+	})
+	idx.pending = append(idx.pending, numEntry{})
+	copy(idx.pending[i+1:], idx.pending[i:])
+	idx.pending[i] = e
+	if n := len(idx.pending); n > 256 && n*n > len(idx.sorted) {
+		idx.sorted = mergeNumEntries(idx.sorted, idx.pending)
+		idx.pending = nil
+	}
+}
+
+// key returns the key of a doc, and whether the doc has a value.
+func (idx *numericIndex) key(docID int32) (uint64, bool) {
+	if idx == nil || int(docID) >= len(idx.has) || !idx.has[docID] {
+		return 0, false
+	}
+	return idx.keys[docID], true
+}
+
+// docList returns the sorted docIDs whose keys are in [lo, hi].
+func (idx *numericIndex) docList(lo, hi uint64) []int32 {
+	if idx == nil || lo > hi {
+		return nil
+	}
+	var res []int32
+	for _, entries := range [][]numEntry{idx.sorted, idx.pending} {
+		i := sort.Search(len(entries), func(i int) bool {
+			return entries[i].key >= lo
+		})
+		for ; i < len(entries) && entries[i].key <= hi; i++ {
+			res = append(res, entries[i].docID)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return res
+}
+
+// mergeNumEntries merges two sorted lists into a new sorted list.
+func mergeNumEntries(a, b []numEntry) []numEntry {
+	res := make([]numEntry, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if !lessNumEntry(b[j], a[i]) {
+			res, i = append(res, a[i]), i+1
+		} else {
+			res, j = append(res, b[j]), j+1
+		}
+	}
+	res = append(res, a[i:]...)
+	return append(res, b[j:]...)
+}
+
+// newNumericIndex returns a numericIndex of keys of docIDs.
+func newNumericIndex(isFloat bool, docIDs []int32, keys []uint64) *numericIndex {
+	idx := &numericIndex{isFloat: isFloat}
+	idx.sorted = make([]numEntry, len(docIDs))
+	for i, docID := range docIDs {
+		for len(idx.keys) <= int(docID) {
+			idx.keys, idx.has = append(idx.keys, 0), append(idx.has, false)
+		}
+		idx.keys[docID], idx.has[docID] = keys[i], true
+		idx.sorted[i] = numEntry{key: keys[i], docID: docID}
+	}
+	sort.Slice(idx.sorted, func(i, j int) bool {
+		return lessNumEntry(idx.sorted[i], idx.sorted[j])
+	})
+	return idx
+}
+
+// entries returns the docIDs with values and their keys in the order of
+// docIDs.
+func (idx *numericIndex) entries() (docIDs []int32, keys []uint64) {
+	for docID, has := range idx.has {
+		if has {
+			docIDs, keys = append(docIDs, int32(docID)), append(keys, idx.keys[docID])
+		}
+	}
+	return docIDs, keys
+}
+
+// AddDocNumeric indexes a document like AddDoc, with numeric fields which can
+// be queried by IntRange and FloatRange. It returns a local doc ID.
+func (s *TokenSetSearcher) AddDocNumeric(fields map[string]stringsp.Set, nums NumericFields, data interface{}) int32 {
+	docID := s.AddDoc(fields, data)
+	for fld, v := range nums.Ints {
+		idx := s.numericIndex(fld, false)
+		if idx.isFloat {
+			idx.add(docID, floatKey(float64(v)))
+		} else {
+			idx.add(docID, intKey(v))
+		}
+	}
+	for fld, v := range nums.Floats {
+		idx := s.numericIndex(fld, true)
+		if idx.isFloat {
+			idx.add(docID, floatKey(v))
+		} else {
+			idx.add(docID, intKey(int64(v)))
+		}
+	}
+	return docID
+}
+
+// numericIndex returns the index of a numeric field, creating it with the
+// kind of isFloat if not existing.
+func (s *TokenSetSearcher) numericIndex(fld string, isFloat bool) *numericIndex {
+	idx := s.numbers[fld]
+	if idx == nil {
+		if s.numbers == nil {
+			s.numbers = make(map[string]*numericIndex)
+		}
+		idx = &numericIndex{isFloat: isFloat}
+		s.numbers[fld] = idx
+	}
+	return idx
+}
+
+// DocInt returns the value of an int field of a doc, and whether the doc has
+// a value. Values of a float field are converted.
+func (s *TokenSetSearcher) DocInt(docID int32, field string) (int64, bool) {
+	idx := s.numbers[field]
+	key, ok := idx.key(docID)
+	if !ok {
+		return 0, false
+	}
+	if idx.isFloat {
+		return int64(keyFloat(key)), true
+	}
+	return keyInt(key), true
+}
+
+// DocFloat returns the value of a float field of a doc, and whether the doc
+// has a value. Values of an int field are converted.
+func (s *TokenSetSearcher) DocFloat(docID int32, field string) (float64, bool) {
+	idx := s.numbers[field]
+	key, ok := idx.key(docID)
+	if !ok {
+		return 0, false
+	}
+	if idx.isFloat {
+		return keyFloat(key), true
+	}
+	return float64(keyInt(key)), true
+}
+
+// compactNumbers removes values of deleted docs, where newIDs is the mapping
+// returned by Compact.
+func (s *TokenSetSearcher) compactNumbers(newIDs []int32) {
+	for fld, idx := range s.numbers {
+		docIDs, keys := idx.entries()
+		var newDocIDs []int32
+		var newKeys []uint64
+		for i, docID := range docIDs {
+			if newID := newIDs[docID]; newID >= 0 {
+				newDocIDs, newKeys = append(newDocIDs, newID), append(newKeys, keys[i])
+			}
+		}
+		s.numbers[fld] = newNumericIndex(idx.isFloat, newDocIDs, newKeys)
+	}
+}
+
+// IntRange matches documents whose value of numeric Field is in [Min, Max].
+// Use math.MinInt64 or math.MaxInt64 for an open end.
+type IntRange struct {
+	Field    string
+	Min, Max int64
+}
+
+// FloatRange matches documents whose value of numeric Field is in [Min, Max].
+// Use math.Inf for an open end. NaN values never match.
+type FloatRange struct {
+	Field    string
+	Min, Max float64
+}
+
+func (q IntRange) docList(s *TokenSetSearcher) []int32 {
+	idx := s.numbers[q.Field]
+	if idx != nil && idx.isFloat {
+		return idx.docList(floatKey(float64(q.Min)), floatKey(float64(q.Max)))
+	}
+	return idx.docList(intKey(q.Min), intKey(q.Max))
+}
+
+func (q FloatRange) docList(s *TokenSetSearcher) []int32 {
+	if math.IsNaN(q.Min) || math.IsNaN(q.Max) {
+		return nil
+	}
+	idx := s.numbers[q.Field]
+	if idx == nil || idx.isFloat {
+		return idx.docList(floatKey(q.Min), floatKey(q.Max))
+	}
+	// the int range covered by the float range
+	lo, hi := math.Ceil(q.Min), math.Floor(q.Max)
+	if lo > hi || lo >= math.MaxInt64 || hi < math.MinInt64 {
+		return nil
+	}
+	mn, mx := int64(math.MinInt64), int64(math.MaxInt64)
+	if lo > math.MinInt64 {
+		mn = int64(lo)
+	}
+	if hi < math.MaxInt64 {
+		mx = int64(hi)
+	}
+	return idx.docList(intKey(mn), intKey(mx))
+}
@@ -0,0 +1,119 @@
+package index
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestNumericKeys(t *testing.T) {
+	ints := []int64{math.MinInt64, -1000, -1, 0, 1, 42, math.MaxInt64}
+	for i := 1; i < len(ints); i++ {
+		assert.True(t, "int order", intKey(ints[i-1]) < intKey(ints[i]))
+	}
+	for _, v := range ints {
+		assert.Equal(t, "keyInt", keyInt(intKey(v)), v)
+	}
+	floats := []float64{math.Inf(-1), -1e300, -1.5, -1e-300, 0, 1e-300, 1.5, 1e300, math.Inf(1)}
+	for i := 1; i < len(floats); i++ {
+		assert.True(t, "float order", floatKey(floats[i-1]) < floatKey(floats[i]))
+	}
+	for _, v := range floats {
+		assert.Equal(t, "keyFloat", keyFloat(floatKey(v)), v)
+	}
+	assert.Equal(t, "-0", floatKey(math.Copysign(0, -1)), floatKey(0))
+}
+
+func TestTokenSetSearcher_NumericRange(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	const n = 1000
+	for i := 0; i < n; i++ {
+		tokens := stringsp.NewSet("go")
+		if i%2 == 0 {
+			tokens.Add("even")
+		}
+		nums := NumericFields{
+			Ints:   map[string]int64{"stars": int64(i * 10)},
+			Floats: map[string]float64{"score": float64(i) / 4},
+		}
+		if i%100 == 7 {
+			// docs without stars
+			delete(nums.Ints, "stars")
+		}
+		sch.AddDocNumeric(map[string]stringsp.Set{"text": tokens}, nums, i)
+	}
+	v, ok := sch.DocInt(3, "stars")
+	assert.True(t, "ok", ok)
+	assert.Equal(t, "stars", v, int64(30))
+	_, ok = sch.DocInt(7, "stars")
+	assert.False(t, "ok", ok)
+	f, ok := sch.DocFloat(3, "score")
+	assert.True(t, "ok", ok)
+	assert.Equal(t, "score", f, 0.75)
+	f, ok = sch.DocFloat(3, "stars")
+	assert.True(t, "ok", ok)
+	assert.Equal(t, "stars", f, 30.0)
+
+	check := func(sch *TokenSetSearcher) {
+		assert.StringEqual(t, "stars", searchQueryDocs(t, sch, IntRange{"stars", 100, 150}),
+			"[10 11 12 13 14 15]")
+		assert.StringEqual(t, "stars even", searchQueryDocs(t, sch, And{
+			Term{"text", "even"}, IntRange{"stars", 100, 150},
+		}), "[10 12 14]")
+		assert.StringEqual(t, "missing", searchQueryDocs(t, sch, IntRange{"stars", 70, 70}), "[]")
+		assert.StringEqual(t, "open", len(searchQueryDocs(t, sch, IntRange{"stars", math.MinInt64, math.MaxInt64})), "990")
+		assert.StringEqual(t, "score", searchQueryDocs(t, sch, FloatRange{"score", 1.1, 2}),
+			"[5 6 7 8]")
+		assert.StringEqual(t, "float on int", searchQueryDocs(t, sch, FloatRange{"stars", 95.5, 120}),
+			"[10 11 12]")
+		assert.StringEqual(t, "int on float", searchQueryDocs(t, sch, IntRange{"score", 1, 2}),
+			"[4 5 6 7 8]")
+		assert.StringEqual(t, "not", len(searchQueryDocs(t, sch, And{
+			Term{"text", "go"}, Not{FloatRange{"score", math.Inf(-1), 200}},
+		})), "199")
+		assert.StringEqual(t, "NaN", searchQueryDocs(t, sch, FloatRange{"score", math.NaN(), 1}), "[]")
+		assert.StringEqual(t, "unknown", searchQueryDocs(t, sch, IntRange{"unknown", 0, 100}), "[]")
+	}
+	check(sch)
+
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	var loaded TokenSetSearcher
+	assert.NoErrorOrDie(t, loaded.Load(bytes.NewReader(b)))
+	check(&loaded)
+
+	assert.NoError(t, sch.DeleteDoc(11))
+	assert.StringEqual(t, "deleted", searchQueryDocs(t, sch, IntRange{"stars", 100, 150}),
+		"[10 12 13 14 15]")
+	sch.Compact()
+	assert.StringEqual(t, "compacted", searchQueryDocs(t, sch, IntRange{"stars", 100, 150}),
+		"[10 11 12 13 14]")
+	v, ok = sch.DocInt(11, "stars")
+	assert.True(t, "ok", ok)
+	assert.Equal(t, "stars", v, int64(120))
+}
+
+func TestNumericIndex_Pending(t *testing.T) {
+	// values added in random order are merged correctly
+	idx := &numericIndex{}
+	var vals []int
+	for i := 0; i < 3000; i++ {
+		v := (i * 7919) % 3001
+		idx.add(int32(i), intKey(int64(v)))
+		vals = append(vals, v)
+	}
+	var exp []int32
+	for i, v := range vals {
+		if v >= 1000 && v <= 1100 {
+			exp = append(exp, int32(i))
+		}
+	}
+	sort.Slice(exp, func(i, j int) bool { return exp[i] < exp[j] })
+	assert.Equal(t, "docList", idx.docList(intKey(1000), intKey(1100)), exp)
+	assert.ValueShould(t, "pending", len(idx.pending), len(idx.pending) < 3000, "should be merged")
+}
@@ -0,0 +1,62 @@
+package index
+
+import (
+	"errors"
+	"math"
+)
+
+// errStopIteration is returned by output functions to stop iterations early.
+var errStopIteration = errors.New("stop iteration")
+
+// Page is a page of search results returned by SearchPage.
+type Page struct {
+	DocIDs []int32
+	Data   []interface{}
+	// Total is the number of all hits of the query.
+	Total int
+	// TotalEstimated is true if Total is estimated rather than counted.
+	TotalEstimated bool
+}
+
+// SearchPage returns at most limit documents matching q, skipping the first
+// offset ones, in the same order as SearchQuery.
+//
+// If estimateTotal is false, all hits are counted for an exact Total.
+// Otherwise, the search stops as soon as the page is filled, and Total is
+// extrapolated from the fraction of docIDs scanned. For a conjunction of Terms
+// (e.g. converted by MapQuery), the rest of the intersection is skipped.
+func (s *TokenSetSearcher) SearchPage(q Query, offset, limit int, estimateTotal bool) Page {
+	var page Page
+	if offset < 0 {
+		offset = 0
+	}
+	if limit > math.MaxInt-offset {
+		limit = math.MaxInt - offset
+	}
+	end := offset + limit
+	lastDocID := int32(-1)
+	err := s.iterateDocs(q, func(docID int32) error {
+		if s.isDeleted(docID) {
+			return nil
+		}
+		if page.Total >= offset && page.Total < end {
+			page.DocIDs = append(page.DocIDs, docID)
+			page.Data = append(page.Data, s.DocInfo(docID))
+		}
+		page.Total++
+		lastDocID = docID
+		if estimateTotal && page.Total >= end {
+			return errStopIteration
+		}
+		return nil
+	})
+	if err == errStopIteration && int(lastDocID)+1 < len(s.docs) {
+		// assuming hits are evenly distributed in docIDs
+		estimated := int64(page.Total) * int64(len(s.docs)) / (int64(lastDocID) + 1)
+		if estimated > int64(page.Total) {
+			page.Total = int(estimated)
+			page.TotalEstimated = true
+		}
+	}
+	return page
+}
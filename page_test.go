@@ -0,0 +1,47 @@
+package index
+
+import (
+	"math"
+	"testing"
+
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTokenSetSearcher_SearchPage(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	for i := 0; i < 100; i++ {
+		tokens := stringsp.NewSet("a")
+		if i%2 == 0 {
+			tokens.Add("b")
+		}
+		sch.AddDoc(map[string]stringsp.Set{"text": tokens}, i)
+	}
+	assert.NoError(t, sch.DeleteDoc(2))
+
+	q := MapQuery(SingleFieldQuery("text", "a", "b"))
+	page := sch.SearchPage(q, 2, 3, false)
+	assert.StringEqual(t, "DocIDs", page.DocIDs, "[6 8 10]")
+	assert.StringEqual(t, "Data", page.Data, "[6 8 10]")
+	assert.Equal(t, "Total", page.Total, 49)
+	assert.False(t, "TotalEstimated", page.TotalEstimated)
+
+	page = sch.SearchPage(q, 2, 3, true)
+	assert.StringEqual(t, "DocIDs", page.DocIDs, "[6 8 10]")
+	assert.Equal(t, "Total", page.Total, 5*100/11)
+	assert.True(t, "TotalEstimated", page.TotalEstimated)
+
+	page = sch.SearchPage(Term{"text", "b"}, 45, 10, true)
+	assert.StringEqual(t, "DocIDs", page.DocIDs, "[92 94 96 98]")
+	assert.Equal(t, "Total", page.Total, 49)
+	assert.False(t, "TotalEstimated", page.TotalEstimated)
+
+	page = sch.SearchPage(q, 100, 10, true)
+	assert.Equal(t, "DocIDs", len(page.DocIDs), 0)
+	assert.Equal(t, "Total", page.Total, 49)
+
+	// no overflow of offset+limit
+	page = sch.SearchPage(q, 47, math.MaxInt, false)
+	assert.StringEqual(t, "DocIDs", page.DocIDs, "[96 98]")
+	assert.Equal(t, "Total", page.Total, 49)
+}
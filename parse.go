@@ -0,0 +1,335 @@
+package index
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseOptions are the options of ParseQuery.
+type ParseOptions struct {
+	// The field of terms without a field prefix.
+	DefaultField string
+	// Tokenizers of fields. Text of a field without a Tokenizer is tokenized
+	// by DefaultTokenizer, or split by spaces if it is nil.
+	Tokenizers       map[string]Tokenizer
+	DefaultTokenizer Tokenizer
+}
+
+// SyntaxError is the error returned by ParseQuery for invalid query strings.
+type SyntaxError struct {
+	// 1-based column, in runes, of the problem.
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("Syntax error at column %d: %s", e.Column, e.Msg)
+}
+
+// ParseQuery parses a query string into a Query. The syntax is:
+//
+//	http server        docs containing both http and server
+//	name:http          http in field name
+//	author:"rob pike"  the phrase "rob pike" in field author
+//	-test              docs not containing test
+//	http OR rpc        docs containing http or rpc
+//	(http OR rpc) net  grouping
+//	name:ht*           a Prefix
+//	name:h?tp*         a Wildcard
+//	name:htpt~ htpt~2  a Fuzzy with a max distance of 1 or 2
+//
+// Terms without a field prefix are in opts.DefaultField. Free text is
+// tokenized by the Tokenizer of its field. A word tokenized into several
+// tokens matches all of them, and a quoted text tokenized into several tokens
+// is a Phrase. Text tokenized into nothing is ignored. A *SyntaxError is
+// returned if the query is invalid or matches nothing but ignored text.
+func ParseQuery(query string, opts ParseOptions) (Query, error) {
+	p := &queryParser{rs: []rune(query), opts: opts}
+	q, n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.rs) {
+		// only a ')' stops parseOr
+		return nil, p.errorf(p.pos, "unmatched ')'")
+	}
+	if n == 0 {
+		return nil, p.errorf(0, "empty query")
+	}
+	if q == nil {
+		return nil, p.errorf(0, "no tokens in query")
+	}
+	return q, nil
+}
+
+type queryParser struct {
+	rs   []rune
+	pos  int
+	opts ParseOptions
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...interface{}) error {
+	return &SyntaxError{Column: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) skipSpaces() {
+	for p.pos < len(p.rs) && unicode.IsSpace(p.rs[p.pos]) {
+		p.pos++
+	}
+}
+
+// isWordRune returns whether r can be in an unquoted word.
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && r != '(' && r != ')' && r != '"'
+}
+
+// atOr returns whether the parser is at an OR keyword.
+func (p *queryParser) atOr() bool {
+	end := p.pos + 2
+	return end <= len(p.rs) && string(p.rs[p.pos:end]) == "OR" &&
+		(end == len(p.rs) || !isWordRune(p.rs[end]))
+}
+
+// parseOr parses clauses separated by OR until the end or a ')'. n is the
+// number of parsed clauses, and q is nil if all of them are ignored.
+func (p *queryParser) parseOr() (q Query, n int, err error) {
+	var or Or
+	for {
+		start := p.pos
+		sub, m, err := p.parseAnd()
+		if err != nil {
+			return nil, 0, err
+		}
+		if m == 0 {
+			if n > 0 {
+				return nil, 0, p.errorf(start, "missing query after OR")
+			}
+			if p.atOr() {
+				return nil, 0, p.errorf(p.pos, "missing query before OR")
+			}
+			return nil, 0, nil
+		}
+		n += m
+		if sub != nil {
+			or = append(or, sub)
+		}
+		if !p.atOr() {
+			break
+		}
+		p.pos += 2
+	}
+	switch len(or) {
+	case 0:
+		return nil, n, nil
+	case 1:
+		return or[0], n, nil
+	}
+	return or, n, nil
+}
+
+// parseAnd parses clauses until the end, a ')' or an OR.
+func (p *queryParser) parseAnd() (q Query, n int, err error) {
+	var and And
+	for {
+		p.skipSpaces()
+		if p.pos == len(p.rs) || p.rs[p.pos] == ')' || p.atOr() {
+			break
+		}
+		sub, err := p.parseUnary()
+		if err != nil {
+			return nil, 0, err
+		}
+		n++
+		if sub != nil {
+			and = append(and, sub)
+		}
+	}
+	switch len(and) {
+	case 0:
+		return nil, n, nil
+	case 1:
+		if _, ok := and[0].(Not); !ok {
+			// a Not is kept in an And, so that it can be put in an Or.
+			return and[0], n, nil
+		}
+	}
+	return and, n, nil
+}
+
+// parseUnary parses a clause with an optional '-' prefix. The returned query
+// is nil if the clause is ignored.
+func (p *queryParser) parseUnary() (Query, error) {
+	if p.rs[p.pos] != '-' {
+		return p.parsePrimary()
+	}
+	start := p.pos
+	p.pos++
+	if p.pos == len(p.rs) || !isWordRune(p.rs[p.pos]) && p.rs[p.pos] != '(' && p.rs[p.pos] != '"' {
+		return nil, p.errorf(start, "missing query after '-'")
+	}
+	q, err := p.parseUnary()
+	if q == nil || err != nil {
+		return nil, err
+	}
+	if not, ok := q.(Not); ok {
+		return not.Query, nil
+	}
+	return Not{Query: q}, nil
+}
+
+// parsePrimary parses a parenthesized query, or a term with an optional
+// field prefix.
+func (p *queryParser) parsePrimary() (Query, error) {
+	if p.rs[p.pos] == '(' {
+		start := p.pos
+		p.pos++
+		q, n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos == len(p.rs) {
+			return nil, p.errorf(start, "unmatched '('")
+		}
+		if n == 0 {
+			return nil, p.errorf(start, "empty parentheses")
+		}
+		p.pos++
+		return q, nil
+	}
+	field := p.opts.DefaultField
+	if i := p.fieldEnd(); i > p.pos {
+		field = string(p.rs[p.pos:i])
+		p.pos = i + 1
+		if p.pos == len(p.rs) || !isWordRune(p.rs[p.pos]) && p.rs[p.pos] != '"' {
+			return nil, p.errorf(p.pos, "missing value of field %q", field)
+		}
+	}
+	if p.rs[p.pos] == '"' {
+		return p.parsePhrase(field)
+	}
+	start := p.pos
+	for p.pos < len(p.rs) && isWordRune(p.rs[p.pos]) {
+		p.pos++
+	}
+	return p.wordQuery(field, string(p.rs[start:p.pos]), start)
+}
+
+// fieldEnd returns the position of the ':' after a field name at the current
+// position, or -1 if there is not one.
+func (p *queryParser) fieldEnd() int {
+	for i := p.pos; i < len(p.rs); i++ {
+		r := p.rs[i]
+		if r == ':' {
+			return i
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' && r != '-' {
+			return -1
+		}
+	}
+	return -1
+}
+
+// parsePhrase parses a quoted text in field.
+func (p *queryParser) parsePhrase(field string) (Query, error) {
+	start := p.pos
+	p.pos++
+	end := p.pos
+	for end < len(p.rs) && p.rs[end] != '"' {
+		end++
+	}
+	if end == len(p.rs) {
+		return nil, p.errorf(start, "unterminated quote")
+	}
+	text := string(p.rs[p.pos:end])
+	p.pos = end + 1
+	tokens, err := p.tokenize(field, text)
+	if err != nil {
+		return nil, err
+	}
+	switch len(tokens) {
+	case 0:
+		return nil, nil
+	case 1:
+		return Term{Field: field, Token: tokens[0]}, nil
+	}
+	return Phrase{Field: field, Tokens: tokens}, nil
+}
+
+// wordQuery returns the query of an unquoted word in field starting at start.
+func (p *queryParser) wordQuery(field, word string, start int) (Query, error) {
+	if i := strings.LastIndexByte(word, '~'); i > 0 {
+		dist := 1
+		if i < len(word)-1 {
+			d, err := strconv.Atoi(word[i+1:])
+			if err != nil || d < 0 {
+				return nil, p.errorf(start+len([]rune(word[:i+1])), "invalid fuzzy distance %q", word[i+1:])
+			}
+			dist = d
+		}
+		token, err := p.singleToken(field, word[:i], start)
+		if err != nil {
+			return nil, err
+		}
+		return Fuzzy{Field: field, Token: token, MaxDistance: dist}, nil
+	}
+	if i := strings.IndexAny(word, "*?"); i >= 0 {
+		if i == len(word)-1 && word[i] == '*' {
+			prefix, err := p.singleToken(field, word[:i], start)
+			if err != nil {
+				return nil, err
+			}
+			return Prefix{Field: field, Prefix: prefix}, nil
+		}
+		// patterns are not tokenized
+		return Wildcard{Field: field, Pattern: word}, nil
+	}
+	tokens, err := p.tokenize(field, word)
+	if err != nil {
+		return nil, err
+	}
+	switch len(tokens) {
+	case 0:
+		return nil, nil
+	case 1:
+		return Term{Field: field, Token: tokens[0]}, nil
+	}
+	and := make(And, len(tokens))
+	for i, token := range tokens {
+		and[i] = Term{Field: field, Token: token}
+	}
+	return and, nil
+}
+
+// singleToken tokenizes text of a prefix or fuzzy query at start, which must
+// be a single token.
+func (p *queryParser) singleToken(field, text string, start int) (string, error) {
+	tokens, err := p.tokenize(field, text)
+	if err != nil {
+		return "", err
+	}
+	if len(tokens) != 1 {
+		return "", p.errorf(start, "%q is not a single token", text)
+	}
+	return tokens[0], nil
+}
+
+// tokenize tokenizes text of field.
+func (p *queryParser) tokenize(field, text string) ([]string, error) {
+	tk := p.opts.Tokenizers[field]
+	if tk == nil {
+		tk = p.opts.DefaultTokenizer
+	}
+	if tk == nil {
+		return strings.Fields(text), nil
+	}
+	var tokens []string
+	if err := tk.Tokenize(strings.NewReader(text), func(token []byte) error {
+		tokens = append(tokens, string(token))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
@@ -0,0 +1,103 @@
+package index
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"unicode"
+
+	"github.com/golangplus/testing/assert"
+)
+
+// lowerTokenizer splits text by non-alphanumeric runes, and lowers tokens.
+type lowerTokenizer struct{}
+
+func (lowerTokenizer) Tokenize(in io.RuneReader, output func(token []byte) error) error {
+	return Tokenize(SeparatorFRuneTypeFunc(func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), in, func(token []byte) error {
+		return output(bytes.ToLower(token))
+	})
+}
+
+func TestParseQuery(t *testing.T) {
+	opts := ParseOptions{
+		DefaultField: "text",
+		Tokenizers: map[string]Tokenizer{
+			"text": lowerTokenizer{},
+		},
+	}
+	for _, c := range []struct {
+		query string
+		exp   Query
+	}{
+		{"http", Term{"text", "http"}},
+		{"Net/HTTP", And{Term{"text", "net"}, Term{"text", "http"}}},
+		{`name:http author:"rob pike" -test`, And{
+			Term{"name", "http"},
+			Phrase{Field: "author", Tokens: []string{"rob", "pike"}},
+			Not{Term{"text", "test"}},
+		}},
+		{`"Go"`, Term{"text", "go"}},
+		{"-test", And{Not{Term{"text", "test"}}}},
+		{"--test", Term{"text", "test"}},
+		{"http OR rpc net", Or{Term{"text", "http"}, And{Term{"text", "rpc"}, Term{"text", "net"}}}},
+		{"(http OR rpc) net", And{Or{Term{"text", "http"}, Term{"text", "rpc"}}, Term{"text", "net"}}},
+		{"a or b", And{Term{"text", "a"}, Term{"text", "or"}, Term{"text", "b"}}},
+		{"-(a OR b)", And{Not{Or{Term{"text", "a"}, Term{"text", "b"}}}}},
+		{"Ht*", Prefix{Field: "text", Prefix: "ht"}},
+		{"name:Ht*", Prefix{Field: "name", Prefix: "Ht"}},
+		{"name:h?t*p", Wildcard{Field: "name", Pattern: "h?t*p"}},
+		{"htpt~ name:x~2", And{
+			Fuzzy{Field: "text", Token: "htpt", MaxDistance: 1},
+			Fuzzy{Field: "name", Token: "x", MaxDistance: 2},
+		}},
+		{"url:http://golang.org", Term{"url", "http://golang.org"}},
+		{"go !!! ", Term{"text", "go"}},
+	} {
+		q, err := ParseQuery(c.query, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, c.query, q, c.exp)
+	}
+
+	for _, c := range []struct {
+		query  string
+		column int
+	}{
+		{"", 1},
+		{"  ", 1},
+		{"!!!", 1},
+		{`name:"rob pike`, 6},
+		{"(a b", 1},
+		{"a b)", 4},
+		{"a ()", 3},
+		{"a -", 3},
+		{"name: x", 6},
+		{"OR a", 1},
+		{"a OR", 5},
+		{"a OR OR b", 5},
+		{"x~y", 3},
+		{"a-b*", 1},
+	} {
+		_, err := ParseQuery(c.query, opts)
+		se, ok := err.(*SyntaxError)
+		assert.True(t, c.query, ok)
+		if ok {
+			assert.Equal(t, c.query, se.Column, c.column)
+		}
+	}
+	assert.StringEqual(t, "Error", (&SyntaxError{Column: 3, Msg: "unmatched '('"}).Error(),
+		"Syntax error at column 3: unmatched '('")
+}
+
+func TestParseQuery_Search(t *testing.T) {
+	sch := indexDocs([][2]string{
+		{"0", "net http server"},
+		{"1", "gorilla mux http"},
+		{"2", "gorilla websocket deprecated"},
+		{"3", "net rpc"},
+	})
+	q, err := ParseQuery("(http OR gorilla) -deprecated", ParseOptions{DefaultField: "text"})
+	assert.NoErrorOrDie(t, err)
+	assert.StringEqual(t, "docs", searchQueryDocs(t, sch, q), "[0 1]")
+}
@@ -0,0 +1,162 @@
+package index
+
+// Phrase matches documents containing Tokens consecutively in Field.
+//
+// Positions are required for verifying, so only documents added by
+// AddDocTokens can match a Phrase of more than one token.
+type Phrase struct {
+	Field  string
+	Tokens []string
+}
+
+// Near matches documents containing all Tokens in Field, in any order, within
+// a window of Distance positions, i.e. the difference between the positions
+// of the first and the last tokens is at most Distance.
+//
+// Like Phrase, only documents added by AddDocTokens can match a Near of more
+// than one token.
+type Near struct {
+	Field    string
+	Tokens   []string
+	Distance int
+}
+
+func (q Phrase) docList(s *TokenSetSearcher) []int32 {
+	if len(q.Tokens) == 1 {
+		return s.postings(q.Field, q.Tokens[0]).docIDs()
+	}
+	return s.positionalDocList(q.Field, q.Tokens, func(poss [][]int32) bool {
+		return matchPhrase(poss)
+	})
+}
+
+func (q Near) docList(s *TokenSetSearcher) []int32 {
+	// a repeated token has to appear at distinct positions, so the positions
+	// of each distinct token are verified against its number of occurrences.
+	var tokens []string
+	var counts []int
+	idxs := make(map[string]int)
+	for _, token := range q.Tokens {
+		i, ok := idxs[token]
+		if !ok {
+			i = len(tokens)
+			idxs[token] = i
+			tokens, counts = append(tokens, token), append(counts, 0)
+		}
+		counts[i]++
+	}
+	if len(tokens) == 1 && counts[0] == 1 {
+		return s.postings(q.Field, tokens[0]).docIDs()
+	}
+	return s.positionalDocList(q.Field, tokens, func(poss [][]int32) bool {
+		return matchNear(poss, counts, int32(q.Distance))
+	})
+}
+
+// positionalDocList intersects the inverted lists of tokens and returns the
+// docs whose positions of tokens (in the same order as tokens) are accepted by
+// match.
+func (s *TokenSetSearcher) positionalDocList(field string, tokens []string, match func(poss [][]int32) bool) []int32 {
+	if len(tokens) == 0 {
+		return nil
+	}
+	fi := s.field(field)
+	iters := make([]*postingIterator, len(tokens))
+	docIters := make([]docIterator, len(tokens))
+	for i, token := range tokens {
+		iters[i] = fi.postings(token).iterator()
+		docIters[i] = iters[i]
+	}
+	var res []int32
+	poss := make([][]int32, len(tokens))
+	intersectDocs(docIters, func(docID int32) error {
+		for i, token := range tokens {
+			if poss[i] = fi.tokenPositions(token, iters[i].idx); len(poss[i]) == 0 {
+				// positions not indexed
+				return nil
+			}
+		}
+		if match(poss) {
+			res = append(res, docID)
+		}
+		return nil
+	})
+	return res
+}
+
+// matchPhrase returns whether there is a position p such that poss[i]
+// contains p + i for all i. Each element of poss is sorted.
+func matchPhrase(poss [][]int32) bool {
+	idxs := make([]int, len(poss))
+	for _, p := range poss[0] {
+		matched := true
+		for i := 1; i < len(poss); i++ {
+			exp := p + int32(i)
+			for idxs[i] < len(poss[i]) && poss[i][idxs[i]] < exp {
+				idxs[i]++
+			}
+			if idxs[i] == len(poss[i]) {
+				return false
+			}
+			if poss[i][idxs[i]] != exp {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchNear returns whether counts[i] distinct positions can be picked from
+// each element poss[i] such that the difference between the maximum and the
+// minimum of all picked positions is at most dist. Each element of poss is
+// sorted, and different elements share no positions.
+func matchNear(poss [][]int32, counts []int, dist int32) bool {
+	if dist < 0 {
+		return false
+	}
+	// a window of positions from lo to hi, both visited in increasing order
+	lo, hi := make([]int, len(poss)), make([]int, len(poss))
+	in := make([]int, len(poss))
+	satisfied := 0
+	for {
+		i := nextPosition(poss, hi)
+		if i < 0 {
+			return false
+		}
+		p := poss[i][hi[i]]
+		hi[i]++
+		if in[i]++; in[i] == counts[i] {
+			satisfied++
+		}
+		for {
+			j := nextPosition(poss, lo)
+			if poss[j][lo[j]] >= p-dist {
+				break
+			}
+			lo[j]++
+			if in[j] == counts[j] {
+				satisfied--
+			}
+			in[j]--
+		}
+		if satisfied == len(poss) {
+			return true
+		}
+	}
+}
+
+// nextPosition returns the index i of the element of poss whose position at
+// idxs[i] is the minimum, or -1 if all are exhausted.
+func nextPosition(poss [][]int32, idxs []int) int {
+	mnI := -1
+	for i, ps := range poss {
+		if idxs[i] < len(ps) && (mnI < 0 || ps[idxs[i]] < poss[mnI][idxs[mnI]]) {
+			mnI = i
+		}
+	}
+	return mnI
+}
@@ -0,0 +1,61 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTokenSetSearcher_Phrase(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	sch.AddDocTokens(map[string][]string{"doc": {"a", "http", "server", "in", "go"}}, 0)
+	sch.AddDocTokens(map[string][]string{"doc": {"server", "side", "of", "http"}}, 1)
+	sch.AddDocTokens(map[string][]string{"doc": {"http", "http", "server", "http"}}, 2)
+	sch.AddDoc(map[string]stringsp.Set{"doc": stringsp.NewSet("http", "server")}, 3)
+
+	assert.StringEqual(t, "http server", searchQueryDocs(t, sch,
+		Phrase{"doc", []string{"http", "server"}}), "[0 2]")
+	assert.StringEqual(t, "server http", searchQueryDocs(t, sch,
+		Phrase{"doc", []string{"server", "http"}}), "[2]")
+	assert.StringEqual(t, "http http", searchQueryDocs(t, sch,
+		Phrase{"doc", []string{"http", "http"}}), "[2]")
+	assert.StringEqual(t, "http", searchQueryDocs(t, sch,
+		Phrase{"doc", []string{"http"}}), "[0 1 2 3]")
+	assert.StringEqual(t, "empty", searchQueryDocs(t, sch, Phrase{"doc", nil}), "[]")
+	assert.StringEqual(t, "in Or", searchQueryDocs(t, sch, Or{
+		Phrase{"doc", []string{"server", "side"}},
+		Phrase{"doc", []string{"in", "go"}},
+	}), "[0 1]")
+}
+
+func TestTokenSetSearcher_Near(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	sch.AddDocTokens(map[string][]string{"doc": {"a", "http", "server", "in", "go"}}, 0)
+	sch.AddDocTokens(map[string][]string{"doc": {"server", "side", "of", "http"}}, 1)
+	sch.AddDocTokens(map[string][]string{"doc": {"go", "x", "x", "x", "x", "http"}}, 2)
+
+	assert.StringEqual(t, "NEAR/1", searchQueryDocs(t, sch,
+		Near{"doc", []string{"server", "http"}, 1}), "[0]")
+	assert.StringEqual(t, "NEAR/3", searchQueryDocs(t, sch,
+		Near{"doc", []string{"server", "http"}, 3}), "[0 1]")
+	assert.StringEqual(t, "NEAR/3 3 tokens", searchQueryDocs(t, sch,
+		Near{"doc", []string{"go", "http", "server"}, 3}), "[0]")
+	assert.StringEqual(t, "NEAR/2", searchQueryDocs(t, sch,
+		Near{"doc", []string{"go", "http"}, 2}), "[]")
+	assert.StringEqual(t, "NEAR/4", searchQueryDocs(t, sch,
+		Near{"doc", []string{"go", "http"}, 4}), "[0]")
+	assert.StringEqual(t, "NEAR/5", searchQueryDocs(t, sch,
+		Near{"doc", []string{"go", "http"}, 5}), "[0 2]")
+
+	// a repeated token matches distinct positions only
+	sch.AddDocTokens(map[string][]string{"doc": {"go", "x", "go", "http"}}, 3)
+	assert.StringEqual(t, "go go NEAR/1", searchQueryDocs(t, sch,
+		Near{"doc", []string{"go", "go"}, 1}), "[]")
+	assert.StringEqual(t, "go go NEAR/2", searchQueryDocs(t, sch,
+		Near{"doc", []string{"go", "go"}, 2}), "[3]")
+	assert.StringEqual(t, "go http go NEAR/2", searchQueryDocs(t, sch,
+		Near{"doc", []string{"go", "http", "go"}, 2}), "[]")
+	assert.StringEqual(t, "go http go NEAR/3", searchQueryDocs(t, sch,
+		Near{"doc", []string{"go", "http", "go"}, 3}), "[3]")
+}
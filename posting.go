@@ -0,0 +1,305 @@
+package index
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// postingList is a sorted list of docIDs compressed with delta and varint
+// encoding.
+type postingList struct {
+	// varint encoded differences between adjacent docIDs. The first one is
+	// the difference from zero.
+	data []byte
+	// number of docIDs
+	n int
+	// the last docID
+	last int32
+	// skips[k] points to the docID at index (k+1)*skipInterval-1
+	skips []postingSkip
+}
+
+// skipInterval is the number of docIDs between adjacent skip pointers.
+const skipInterval = 64
+
+// postingSkip is a skip pointer to an element of a postingList.
+type postingSkip struct {
+	docID int32
+	// offset in data after the element
+	pos int
+}
+
+// newPostingList returns a postingList containing the sorted ids.
+func newPostingList(ids []int32) *postingList {
+	l := &postingList{}
+	for _, docID := range ids {
+		l.append(docID)
+	}
+	return l
+}
+
+// append adds a docID larger than all existing ones.
+func (l *postingList) append(docID int32) {
+	var buf [binary.MaxVarintLen32]byte
+	n := binary.PutUvarint(buf[:], uint64(docID-l.last))
+	l.data = append(l.data, buf[:n]...)
+	l.n++
+	l.last = docID
+	if l.n%skipInterval == 0 {
+		l.skips = append(l.skips, postingSkip{docID: docID, pos: len(l.data)})
+	}
+}
+
+// buildIndex computes last and skips from data and n. It returns false if
+// data are not n increasing docIDs less than numDocs, e.g. corrupted.
+func (l *postingList) buildIndex(numDocs int) bool {
+	l.last, l.skips = 0, nil
+	pos := 0
+	for i := 0; i < l.n; i++ {
+		delta, sz := binary.Uvarint(l.data[pos:])
+		if sz <= 0 || i > 0 && delta == 0 || delta >= uint64(numDocs) {
+			return false
+		}
+		docID := int64(l.last) + int64(delta)
+		if docID >= int64(numDocs) {
+			return false
+		}
+		pos += sz
+		l.last = int32(docID)
+		if (i+1)%skipInterval == 0 {
+			l.skips = append(l.skips, postingSkip{docID: l.last, pos: pos})
+		}
+	}
+	return pos == len(l.data)
+}
+
+// len returns the number of docIDs in the list. It is safe for a nil list.
+func (l *postingList) len() int {
+	if l == nil {
+		return 0
+	}
+	return l.n
+}
+
+// docIDs returns the decoded docIDs.
+func (l *postingList) docIDs() []int32 {
+	if l.len() == 0 {
+		return nil
+	}
+	ids := make([]int32, 0, l.n)
+	for it := l.iterator(); it.next(); {
+		ids = append(ids, it.docID())
+	}
+	return ids
+}
+
+// iterator returns a postingIterator before the first docID of the list. It
+// is safe for a nil list.
+func (l *postingList) iterator() *postingIterator {
+	if l == nil {
+		return &postingIterator{}
+	}
+	return &postingIterator{data: l.data, n: l.n, skips: l.skips, idx: -1}
+}
+
+// docIterator iterates over a sorted list of docIDs. An iterator starts
+// before the first docID.
+type docIterator interface {
+	// next moves to the next docID. It returns false if no more docIDs.
+	next() bool
+	// advance moves to the first docID not less than target. It never moves
+	// backward, and returns false if no such docID.
+	advance(target int32) bool
+	// docID returns the current docID.
+	docID() int32
+	// len returns the total number of docIDs.
+	len() int
+}
+
+// postingIterator is the docIterator of a postingList.
+type postingIterator struct {
+	data []byte
+	// offset of the next varint in data
+	pos   int
+	n     int
+	skips []postingSkip
+	// index of the current docID in the list
+	idx int
+	cur int32
+}
+
+func (it *postingIterator) next() bool {
+	if it.idx+1 >= it.n {
+		it.idx = it.n
+		return false
+	}
+	delta, sz := binary.Uvarint(it.data[it.pos:])
+	it.pos += sz
+	it.cur += int32(delta)
+	it.idx++
+	return true
+}
+
+func (it *postingIterator) advance(target int32) bool {
+	if it.idx >= it.n {
+		return false
+	}
+	if it.idx >= 0 && it.cur >= target {
+		return true
+	}
+	// the next skip pointer after the current element
+	k := (it.idx + 1) / skipInterval
+	if k < len(it.skips) && it.skips[k].docID < target {
+		// gallop to find the last skip pointer less than target
+		step := 1
+		for k+step < len(it.skips) && it.skips[k+step].docID < target {
+			k += step
+			step *= 2
+		}
+		for step /= 2; step > 0; step /= 2 {
+			if k+step < len(it.skips) && it.skips[k+step].docID < target {
+				k += step
+			}
+		}
+		it.idx, it.cur, it.pos = (k+1)*skipInterval-1, it.skips[k].docID, it.skips[k].pos
+	}
+	for it.next() {
+		if it.cur >= target {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *postingIterator) docID() int32 { return it.cur }
+func (it *postingIterator) len() int     { return it.n }
+
+// sliceIterator is the docIterator of a sorted []int32.
+type sliceIterator struct {
+	list []int32
+	idx  int
+}
+
+func newSliceIterator(list []int32) *sliceIterator {
+	return &sliceIterator{list: list, idx: -1}
+}
+
+func (it *sliceIterator) next() bool {
+	if it.idx+1 >= len(it.list) {
+		it.idx = len(it.list)
+		return false
+	}
+	it.idx++
+	return true
+}
+
+func (it *sliceIterator) advance(target int32) bool {
+	if it.idx >= len(it.list) {
+		return false
+	}
+	if it.idx >= 0 && it.list[it.idx] >= target {
+		return true
+	}
+	// gallop to find a range [lo, hi) containing the first element not
+	// less than target
+	lo, step := it.idx+1, 1
+	for lo+step-1 < len(it.list) && it.list[lo+step-1] < target {
+		lo += step
+		step *= 2
+	}
+	hi := lo + step - 1
+	if hi > len(it.list) {
+		hi = len(it.list)
+	}
+	it.idx = lo + sort.Search(hi-lo, func(i int) bool {
+		return it.list[lo+i] >= target
+	})
+	return it.idx < len(it.list)
+}
+
+func (it *sliceIterator) docID() int32 { return it.list[it.idx] }
+func (it *sliceIterator) len() int     { return len(it.list) }
+
+// rangeIterator is the docIterator of all docIDs in [0, n), without
+// allocating the list.
+type rangeIterator struct {
+	n, cur int32
+}
+
+func newRangeIterator(n int) *rangeIterator {
+	return &rangeIterator{n: int32(n), cur: -1}
+}
+
+func (it *rangeIterator) next() bool {
+	if it.cur < it.n {
+		it.cur++
+	}
+	return it.cur < it.n
+}
+
+func (it *rangeIterator) advance(target int32) bool {
+	if target > it.cur {
+		it.cur = target
+		if it.cur > it.n {
+			it.cur = it.n
+		}
+	}
+	return it.cur < it.n
+}
+
+func (it *rangeIterator) docID() int32 { return it.cur }
+func (it *rangeIterator) len() int     { return int(it.n) }
+
+// intersectDocs outputs the docIDs contained in all of iters in increasing
+// order. When output is called, all iterators are at the docID. If output
+// returns an error, the iteration stops, and the error is returned.
+func intersectDocs(iters []docIterator, output func(docID int32) error) error {
+	if len(iters) == 0 {
+		return nil
+	}
+	for _, it := range iters {
+		if it.len() == 0 {
+			return nil
+		}
+	}
+	// the shortest list leads the iteration
+	lead := iters[0]
+	for _, it := range iters[1:] {
+		if it.len() < lead.len() {
+			lead = it
+		}
+	}
+	if !lead.next() {
+		return nil
+	}
+	docID := lead.docID()
+	for {
+		matched := true
+		for _, it := range iters {
+			if it == lead {
+				continue
+			}
+			if !it.advance(docID) {
+				return nil
+			}
+			if d := it.docID(); d > docID {
+				// skip docIDs in lead which are missing in it
+				if !lead.advance(d) {
+					return nil
+				}
+				docID, matched = lead.docID(), false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if err := output(docID); err != nil {
+			return err
+		}
+		if !lead.next() {
+			return nil
+		}
+		docID = lead.docID()
+	}
+}
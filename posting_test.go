@@ -0,0 +1,125 @@
+package index
+
+import (
+	"encoding/gob"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestPostingList(t *testing.T) {
+	ids := []int32{0, 1, 5, 200, 100000, 100001}
+	l := newPostingList(ids)
+	assert.Equal(t, "len", l.len(), len(ids))
+	assert.Equal(t, "docIDs", l.docIDs(), ids)
+	assert.True(t, "compressed", len(l.data) < 4*len(ids))
+
+	it := l.iterator()
+	assert.True(t, "advance(3)", it.advance(3))
+	assert.Equal(t, "docID", it.docID(), int32(5))
+	assert.Equal(t, "idx", it.idx, 2)
+	assert.True(t, "advance(5)", it.advance(5))
+	assert.Equal(t, "docID", it.docID(), int32(5))
+	assert.True(t, "advance(100000)", it.advance(100000))
+	assert.Equal(t, "idx", it.idx, 4)
+	assert.False(t, "advance(100002)", it.advance(100002))
+	assert.False(t, "next", it.next())
+
+	var nilList *postingList
+	assert.Equal(t, "len", nilList.len(), 0)
+	assert.False(t, "next", nilList.iterator().next())
+}
+
+func TestIntersectDocs(t *testing.T) {
+	var res []int32
+	assert.NoError(t, intersectDocs([]docIterator{
+		newPostingList([]int32{1, 3, 5, 7, 9, 11}).iterator(),
+		newSliceIterator([]int32{0, 3, 4, 7, 11, 12}),
+		newPostingList([]int32{3, 7, 8, 11}).iterator(),
+	}, func(docID int32) error {
+		res = append(res, docID)
+		return nil
+	}))
+	assert.StringEqual(t, "res", res, "[3 7 11]")
+
+	res = nil
+	assert.NoError(t, intersectDocs([]docIterator{
+		newRangeIterator(8),
+		newSliceIterator([]int32{0, 3, 4, 7, 11, 12}),
+	}, func(docID int32) error {
+		res = append(res, docID)
+		return nil
+	}))
+	assert.StringEqual(t, "res", res, "[0 3 4 7]")
+	assert.False(t, "next", newRangeIterator(0).next())
+}
+
+func TestTokenSetSearcher_LoadUncompressed(t *testing.T) {
+	// the format saved before inverted lists were compressed
+	var b bytesp.Slice
+	enc := gob.NewEncoder(&b)
+	assert.NoErrorOrDie(t, enc.Encode(2))
+	for _, data := range []interface{}{"a", "b"} {
+		assert.NoErrorOrDie(t, enc.Encode(&data))
+	}
+	assert.NoErrorOrDie(t, enc.Encode(2))
+	assert.NoErrorOrDie(t, enc.Encode("text:go"))
+	assert.NoErrorOrDie(t, enc.Encode([]int32{0, 1}))
+	assert.NoErrorOrDie(t, enc.Encode("text:http"))
+	assert.NoErrorOrDie(t, enc.Encode([]int32{1}))
+
+	var sch TokenSetSearcher
+	assert.NoErrorOrDie(t, sch.Load(&b))
+	assert.Equal(t, "DocCount", sch.DocCount(), 2)
+	assert.StringEqual(t, "go", sch.TokenDocList("text", "go"), "[0 1]")
+	assert.StringEqual(t, "go http", searchQueryDocs(t, &sch,
+		MapQuery(SingleFieldQuery("text", "go", "http"))), "[1]")
+	// appending after loading
+	sch.AddDoc(SingleFieldQuery("text", "go"), "c")
+	assert.StringEqual(t, "go", sch.TokenDocList("text", "go"), "[0 1 2]")
+
+	// the compressed format
+	b = nil
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.NoErrorOrDie(t, sch.Load(&b))
+	sch.AddDoc(SingleFieldQuery("text", "go"), "d")
+	assert.StringEqual(t, "go", sch.TokenDocList("text", "go"), "[0 1 2 3]")
+}
+
+func TestPostingIterator_Skips(t *testing.T) {
+	rand.Seed(1)
+	var ids []int32
+	for docID := int32(0); len(ids) < 1000; docID += int32(rand.Intn(10) + 1) {
+		ids = append(ids, docID)
+	}
+	l := newPostingList(ids)
+	assert.Equal(t, "len(skips)", len(l.skips), 1000/skipInterval)
+
+	var loaded postingList
+	loaded.data, loaded.n = l.data, l.n
+	assert.True(t, "buildIndex", loaded.buildIndex(int(ids[len(ids)-1])+1))
+	assert.Equal(t, "skips", loaded.skips, l.skips)
+	assert.Equal(t, "last", loaded.last, l.last)
+
+	for i := 0; i < 100; i++ {
+		pit, sit := l.iterator(), newSliceIterator(ids)
+		for target := int32(0); ; target += int32(rand.Intn(500)) {
+			exp := sort.Search(len(ids), func(i int) bool {
+				return ids[i] >= target
+			})
+			if exp == len(ids) {
+				assert.False(t, "advance", pit.advance(target))
+				assert.False(t, "advance", sit.advance(target))
+				break
+			}
+			assert.True(t, "advance", pit.advance(target))
+			assert.Equal(t, "idx", pit.idx, exp)
+			assert.Equal(t, "docID", pit.docID(), ids[exp])
+			assert.True(t, "advance", sit.advance(target))
+			assert.Equal(t, "docID", sit.docID(), ids[exp])
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package index
+
+import (
+	"github.com/golangplus/strings"
+)
+
+// Query is a node of a boolean query tree which can be evaluated by
+// TokenSetSearcher.SearchQuery. Valid nodes are Term, And, Or, Not, Phrase,
+// Near, Prefix, Wildcard and Fuzzy.
+type Query interface {
+	// docList returns the sorted docIDs matching the query. The returned
+	// slice may be shared with the searcher and must not be modified.
+	docList(s *TokenSetSearcher) []int32
+}
+
+// Term matches documents containing Token in Field.
+type Term struct {
+	Field string
+	Token string
+}
+
+// And matches documents matching all of its sub-queries. An empty And matches
+// all documents.
+type And []Query
+
+// Or matches documents matching any of its sub-queries. An empty Or matches
+// no documents.
+type Or []Query
+
+// Not matches documents not matching Query. Inside an And, it removes the
+// documents matching Query from the result of other sub-queries.
+type Not struct {
+	Query Query
+}
+
+// MapQuery converts a query in the form of the Search method into a Query,
+// i.e. an And of all field:token Terms.
+func MapQuery(query map[string]stringsp.Set) Query {
+	var q And
+	for fld, tks := range query {
+		for tk := range tks {
+			q = append(q, Term{Field: fld, Token: tk})
+		}
+	}
+	return q
+}
+
+func (t Term) docList(s *TokenSetSearcher) []int32 {
+	return s.postings(t.Field, t.Token).docIDs()
+}
+
+// docIterator returns a docIterator over the docIDs matching q. The posting
+// list of a Term is iterated without decoding it as a whole.
+func (s *TokenSetSearcher) docIterator(q Query) docIterator {
+	if t, ok := q.(Term); ok {
+		return s.postings(t.Field, t.Token).iterator()
+	}
+	return newSliceIterator(q.docList(s))
+}
+
+func (q And) docList(s *TokenSetSearcher) []int32 {
+	var pos []docIterator
+	var neg [][]int32
+	for _, sub := range q {
+		if not, ok := sub.(Not); ok {
+			neg = append(neg, not.Query.docList(s))
+			continue
+		}
+		it := s.docIterator(sub)
+		if it.len() == 0 {
+			return nil
+		}
+		pos = append(pos, it)
+	}
+	var res []int32
+	if len(pos) == 0 {
+		res = allDocList(len(s.docs))
+	} else {
+		intersectDocs(pos, func(docID int32) error {
+			res = append(res, docID)
+			return nil
+		})
+	}
+	for _, list := range neg {
+		res = diffInvLists(res, list)
+	}
+	return res
+}
+
+func (q Or) docList(s *TokenSetSearcher) []int32 {
+	var res []int32
+	for _, sub := range q {
+		res = unionInvLists(res, sub.docList(s))
+	}
+	return res
+}
+
+func (q Not) docList(s *TokenSetSearcher) []int32 {
+	return diffInvLists(allDocList(len(s.docs)), q.Query.docList(s))
+}
+
+// allDocList returns the list of all docIDs for N documents.
+func allDocList(N int) []int32 {
+	list := make([]int32, N)
+	for i := range list {
+		list[i] = int32(i)
+	}
+	return list
+}
+
+// unionInvLists merges two sorted lists into a new sorted list without
+// duplicates.
+func unionInvLists(a, b []int32) []int32 {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	res := make([]int32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			res = append(res, a[i])
+			i++
+		case a[i] > b[j]:
+			res = append(res, b[j])
+			j++
+		default:
+			res = append(res, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	res = append(res, a[i:]...)
+	return append(res, b[j:]...)
+}
+
+// diffInvLists returns the elements of sorted list a which are not in sorted
+// list b.
+func diffInvLists(a, b []int32) []int32 {
+	if len(a) == 0 || len(b) == 0 {
+		return a
+	}
+	res := make([]int32, 0, len(a))
+	j := 0
+	for _, docID := range a {
+		for j < len(b) && b[j] < docID {
+			j++
+		}
+		if j < len(b) && b[j] == docID {
+			continue
+		}
+		res = append(res, docID)
+	}
+	return res
+}
+
+// SearchQuery outputs all documents (docID and associated data) matching the
+// boolean query q, in the same order as they were added. If output returns
+// an error, the search stops, and the error is returned.
+func (s *TokenSetSearcher) SearchQuery(q Query, output func(docID int32, data interface{}) error) error {
+	return s.iterateDocs(q, s.docOutput(output))
+}
+
+// iterateDocs outputs the docIDs matching q in increasing order, including
+// deleted ones. A conjunction of Terms is intersected on the fly without
+// materializing the result list, so stopping early by returning an error
+// from output saves the work, unless the list is looked up in the cache.
+func (s *TokenSetSearcher) iterateDocs(q Query, output func(docID int32) error) error {
+	if and, ok := q.(And); ok && len(and) > 0 {
+		terms := make([]termKey, 0, len(and))
+		for _, sub := range and {
+			t, ok := sub.(Term)
+			if !ok {
+				terms = nil
+				break
+			}
+			id, ok := s.fieldIDs[t.Field]
+			if !ok {
+				// no docs have the field, no results
+				return nil
+			}
+			terms = append(terms, termKey{field: id, token: t.Token})
+		}
+		if terms != nil {
+			if docs, ok := s.cachedIntersection(terms); ok {
+				return intersectDocs([]docIterator{newSliceIterator(docs)}, output)
+			}
+			iters := make([]docIterator, len(terms))
+			for i, t := range terms {
+				iters[i] = s.fields[t.field].inverted[t.token].iterator()
+			}
+			return intersectDocs(iters, output)
+		}
+	}
+	for it := s.docIterator(q); it.next(); {
+		if err := output(it.docID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/golangplus/testing/assert"
+)
+
+func searchQueryDocs(t *testing.T, sch *TokenSetSearcher, q Query) []int32 {
+	var docs []int32
+	assert.NoError(t, sch.SearchQuery(q, func(docID int32, data interface{}) error {
+		docs = append(docs, docID)
+		return nil
+	}))
+	return docs
+}
+
+func TestTokenSetSearcher_SearchQuery(t *testing.T) {
+	sch := indexDocs([][2]string{
+		{"0", "net http server"},
+		{"1", "gorilla mux http"},
+		{"2", "gorilla websocket deprecated"},
+		{"3", "net rpc"},
+	})
+
+	assert.StringEqual(t, "http", searchQueryDocs(t, sch, Term{"text", "http"}), "[0 1]")
+	assert.StringEqual(t, "net http", searchQueryDocs(t, sch, And{
+		Term{"text", "net"}, Term{"text", "http"},
+	}), "[0]")
+	assert.StringEqual(t, "http OR gorilla -deprecated", searchQueryDocs(t, sch, And{
+		Or{Term{"text", "http"}, Term{"text", "gorilla"}},
+		Not{Term{"text", "deprecated"}},
+	}), "[0 1]")
+	assert.StringEqual(t, "net OR websocket", searchQueryDocs(t, sch, Or{
+		Term{"text", "net"}, Term{"text", "websocket"},
+	}), "[0 2 3]")
+	assert.StringEqual(t, "-http", searchQueryDocs(t, sch, Not{Term{"text", "http"}}), "[2 3]")
+	assert.StringEqual(t, "-net -gorilla", searchQueryDocs(t, sch, And{
+		Not{Term{"text", "net"}}, Not{Term{"text", "gorilla"}},
+	}), "[]")
+	assert.StringEqual(t, "empty And", searchQueryDocs(t, sch, And{}), "[0 1 2 3]")
+	assert.StringEqual(t, "empty Or", searchQueryDocs(t, sch, Or{}), "[]")
+	assert.StringEqual(t, "missing", searchQueryDocs(t, sch, And{
+		Term{"text", "http"}, Term{"text", "missing"},
+	}), "[]")
+	assert.StringEqual(t, "MapQuery", searchQueryDocs(t, sch,
+		MapQuery(SingleFieldQuery("text", "gorilla", "http"))), "[1]")
+}
+
+func TestUnionDiffInvLists(t *testing.T) {
+	assert.StringEqual(t, "union", unionInvLists([]int32{1, 3, 5}, []int32{2, 3, 6}), "[1 2 3 5 6]")
+	assert.StringEqual(t, "union empty", unionInvLists(nil, []int32{2}), "[2]")
+	assert.StringEqual(t, "diff", diffInvLists([]int32{1, 3, 5, 7}, []int32{3, 4, 7}), "[1 5]")
+	assert.StringEqual(t, "diff empty", diffInvLists([]int32{1}, nil), "[1]")
+}
@@ -0,0 +1,185 @@
+package index
+
+import (
+	"container/heap"
+	"math"
+)
+
+// RankOptions contains the parameters of BM25 scoring used by
+// TokenSetSearcher.SearchRanked.
+type RankOptions struct {
+	// K1 controls the term-frequency saturation.
+	K1 float64
+	// B controls how much the field length normalizes the score, in [0, 1].
+	B float64
+	// Boosts maps a field to the weight of its scores. Fields not in Boosts
+	// have a weight of 1.
+	Boosts map[string]float64
+}
+
+// DefaultRankOptions is used by SearchRanked if the options are nil.
+var DefaultRankOptions = RankOptions{
+	K1: 1.2,
+	B:  0.75,
+}
+
+// ScoredDoc is a document returned by SearchRanked.
+type ScoredDoc struct {
+	DocID int32
+	// Data is returned by DocInfo, i.e. the error if the data of a doc loaded
+	// lazily fail to be decoded.
+	Data  interface{}
+	Score float64
+}
+
+func (opts *RankOptions) boost(field string) float64 {
+	if w, ok := opts.Boosts[field]; ok {
+		return w
+	}
+	return 1
+}
+
+// positiveTerms appends all Terms of q which are not under a Not node.
+// Prefix, Wildcard and Fuzzy are expanded into Terms.
+func (s *TokenSetSearcher) positiveTerms(q Query, terms []Term) []Term {
+	switch q := q.(type) {
+	case Term:
+		return append(terms, q)
+	case Phrase:
+		for _, token := range q.Tokens {
+			terms = append(terms, Term{Field: q.Field, Token: token})
+		}
+	case Near:
+		for _, token := range q.Tokens {
+			terms = append(terms, Term{Field: q.Field, Token: token})
+		}
+	case Prefix:
+		for _, token := range s.ExpandPrefix(q.Field, q.Prefix, maxExpansions(q.MaxExpansions)) {
+			terms = append(terms, Term{Field: q.Field, Token: token})
+		}
+	case Wildcard:
+		for _, token := range s.ExpandWildcard(q.Field, q.Pattern, maxExpansions(q.MaxExpansions)) {
+			terms = append(terms, Term{Field: q.Field, Token: token})
+		}
+	case Fuzzy:
+		for _, ft := range s.FuzzyTokens(q.Field, q.Token, q.MaxDistance, maxExpansions(q.MaxExpansions)) {
+			terms = append(terms, Term{Field: q.Field, Token: ft.Token})
+		}
+	case And:
+		for _, sub := range q {
+			terms = s.positiveTerms(sub, terms)
+		}
+	case Or:
+		for _, sub := range q {
+			terms = s.positiveTerms(sub, terms)
+		}
+	}
+	return terms
+}
+
+// bm25 computes the BM25 score of a term in a doc.
+func (opts *RankOptions) bm25(N, df int, tf, fieldLen, avgFieldLen float64) float64 {
+	idf := math.Log(1 + (float64(N)-float64(df)+0.5)/(float64(df)+0.5))
+	norm := 1 - opts.B
+	if avgFieldLen > 0 {
+		norm += opts.B * fieldLen / avgFieldLen
+	}
+	return idf * tf * (opts.K1 + 1) / (tf + opts.K1*norm)
+}
+
+// scoredID is a docID with its score. Only scoredIDs are kept while selecting
+// the top documents, so that the data of docs are fetched for the results
+// only.
+type scoredID struct {
+	docID int32
+	score float64
+}
+
+// scoredIDHeap is a min-heap of scoredIDs, the worst one at the top.
+type scoredIDHeap []scoredID
+
+func worseScoredID(a, b scoredID) bool {
+	if a.score != b.score {
+		return a.score < b.score
+	}
+	return a.docID > b.docID
+}
+
+func (h scoredIDHeap) Len() int            { return len(h) }
+func (h scoredIDHeap) Less(i, j int) bool  { return worseScoredID(h[i], h[j]) }
+func (h scoredIDHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *scoredIDHeap) Push(x interface{}) { *h = append(*h, x.(scoredID)) }
+func (h *scoredIDHeap) Pop() interface{} {
+	x := (*h)[len(*h)-1]
+	*h = (*h)[:len(*h)-1]
+	return x
+}
+
+// SearchRanked returns the documents matching q, sorted by BM25 scores in
+// descending order. Documents with the same score are sorted by docID. Only
+// Terms not under a Not node contribute to the scores. If topK > 0, at most
+// topK documents are returned. If opts is nil, DefaultRankOptions is used.
+func (s *TokenSetSearcher) SearchRanked(q Query, topK int, opts *RankOptions) []ScoredDoc {
+	if opts == nil {
+		opts = &DefaultRankOptions
+	}
+	N := len(s.docs)
+	type termInfo struct {
+		Term
+		fi          *fieldIndex
+		it          *postingIterator
+		weight      float64
+		avgFieldLen float64
+	}
+	var terms []termInfo
+	seen := make(map[Term]bool)
+	for _, t := range s.positiveTerms(q, nil) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		fi := s.field(t.Field)
+		info := termInfo{
+			Term:   t,
+			fi:     fi,
+			it:     fi.postings(t.Token).iterator(),
+			weight: opts.boost(t.Field),
+		}
+		if N > 0 && fi != nil {
+			info.avgFieldLen = float64(fi.lenSum) / float64(N)
+		}
+		terms = append(terms, info)
+	}
+
+	var h scoredIDHeap
+	for _, docID := range q.docList(s) {
+		if s.isDeleted(docID) {
+			continue
+		}
+		doc := scoredID{docID: docID}
+		for _, t := range terms {
+			// docIDs are increasing, so the iterators only move forward
+			if !t.it.advance(docID) || t.it.docID() != docID {
+				continue
+			}
+			tf := float64(t.fi.termFreq(t.Token, t.it.idx))
+			doc.score += t.weight * opts.bm25(N, t.it.len(), tf,
+				float64(t.fi.docLen(docID)), t.avgFieldLen)
+		}
+		if topK > 0 && len(h) == topK {
+			if !worseScoredID(h[0], doc) {
+				continue
+			}
+			h[0] = doc
+			heap.Fix(&h, 0)
+		} else {
+			heap.Push(&h, doc)
+		}
+	}
+	docs := make([]ScoredDoc, len(h))
+	for i := len(docs) - 1; i >= 0; i-- {
+		doc := heap.Pop(&h).(scoredID)
+		docs[i] = ScoredDoc{DocID: doc.docID, Data: s.DocInfo(doc.docID), Score: doc.score}
+	}
+	return docs
+}
@@ -0,0 +1,119 @@
+package index
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func rankedDocIDs(docs []ScoredDoc) []int32 {
+	var ids []int32
+	for _, d := range docs {
+		ids = append(ids, d.DocID)
+	}
+	return ids
+}
+
+func TestTokenSetSearcher_SearchRanked(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	sch.AddDoc(map[string]stringsp.Set{
+		"name": stringsp.NewSet("mux"),
+		"doc":  stringsp.NewSet("http", "router", "for", "go"),
+	}, 0)
+	sch.AddDoc(map[string]stringsp.Set{
+		"name": stringsp.NewSet("http"),
+		"doc":  stringsp.NewSet("http", "client", "and", "server"),
+	}, 1)
+	sch.AddDoc(map[string]stringsp.Set{
+		"name": stringsp.NewSet("websocket"),
+		"doc":  stringsp.NewSet("http"),
+	}, 2)
+	sch.AddDoc(map[string]stringsp.Set{
+		"name": stringsp.NewSet("rpc"),
+		"doc":  stringsp.NewSet("rpc"),
+	}, 3)
+
+	q := Or{Term{"name", "http"}, Term{"doc", "http"}}
+	docs := sch.SearchRanked(q, 0, nil)
+	assert.StringEqual(t, "docs", rankedDocIDs(docs), "[1 2 0]")
+	assert.Equal(t, "docs[0].Data", docs[0].Data, 1)
+	assert.True(t, "score decreasing", docs[0].Score > docs[1].Score && docs[1].Score > docs[2].Score)
+
+	// shorter doc field wins without name matching
+	docs = sch.SearchRanked(Term{"doc", "http"}, 0, nil)
+	assert.StringEqual(t, "docs", rankedDocIDs(docs), "[2 0 1]")
+
+	// top-K
+	docs = sch.SearchRanked(q, 2, nil)
+	assert.StringEqual(t, "docs", rankedDocIDs(docs), "[1 2]")
+
+	// boosting doc field with no length normalization makes all equal
+	docs = sch.SearchRanked(Term{"doc", "http"}, 0, &RankOptions{
+		K1:     1.2,
+		Boosts: map[string]float64{"doc": 5},
+	})
+	assert.StringEqual(t, "docs", rankedDocIDs(docs), "[0 1 2]")
+	assert.Equal(t, "score", docs[0].Score, docs[2].Score)
+
+	// Not terms do not contribute
+	docs = sch.SearchRanked(And{Term{"doc", "rpc"}, Not{Term{"name", "http"}}}, 0, nil)
+	assert.StringEqual(t, "docs", rankedDocIDs(docs), "[3]")
+
+	// field lengths are restored after Save/Load
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.NoErrorOrDie(t, sch.Load(&b))
+	docs = sch.SearchRanked(Term{"doc", "http"}, 0, nil)
+	assert.StringEqual(t, "docs", rankedDocIDs(docs), "[2 0 1]")
+}
+
+func TestTokenSetSearcher_SearchRanked_TermFreq(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	sch.AddDocTokens(map[string][]string{"doc": {"http", "router", "go", "go"}}, 0)
+	sch.AddDocTokens(map[string][]string{"doc": {"http", "http", "http", "server"}}, 1)
+	sch.AddDocTokens(map[string][]string{"doc": {"rpc"}}, 2)
+
+	docs := sch.SearchRanked(Term{"doc", "http"}, 0, nil)
+	assert.StringEqual(t, "docs", rankedDocIDs(docs), "[1 0]")
+}
+
+// countedDoc is the data of a doc counting how many times it is decoded.
+type countedDoc int
+
+var decodedDocs int
+
+func (d countedDoc) GobEncode() ([]byte, error) {
+	return []byte{byte(d)}, nil
+}
+
+func (d *countedDoc) GobDecode(bs []byte) error {
+	decodedDocs++
+	*d = countedDoc(bs[0])
+	return nil
+}
+
+func TestTokenSetSearcher_SearchRanked_LazyDocs(t *testing.T) {
+	gob.Register(countedDoc(0))
+	sch := &TokenSetSearcher{}
+	for i := 0; i < 10; i++ {
+		tokens := []string{"go"}
+		for j := 0; j < i; j++ {
+			tokens = append(tokens, "x")
+		}
+		sch.AddDocTokens(map[string][]string{"text": tokens}, countedDoc(i))
+	}
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.NoErrorOrDie(t, sch.LoadWithOptions(bytes.NewReader(b), LoadOptions{LazyDocs: true}))
+
+	// only the data of the returned docs are decoded
+	decodedDocs = 0
+	docs := sch.SearchRanked(Term{"text", "go"}, 2, nil)
+	assert.StringEqual(t, "docs", rankedDocIDs(docs), "[0 1]")
+	assert.Equal(t, "data", docs[1].Data, countedDoc(1))
+	assert.Equal(t, "decodedDocs", decodedDocs, 2)
+}
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"bufio"
 	"encoding/gob"
 	"errors"
 	"io"
@@ -22,26 +23,149 @@ var (
 // registered by calling gob.Register.
 type TokenSetSearcher struct {
 	docs []interface{}
-	// map from token to list of local IDs(indexes in docs field)
-	inverted map[string][]int32
+	// inverted indexes of fields, indexed by interned field IDs
+	fields []*fieldIndex
+	// map from field name to field ID
+	fieldIDs map[string]int32
+	// set of local IDs of deleted docs
+	deleted map[int32]bool
+	// map from field to the index of numeric values
+	numbers map[string]*numericIndex
+	// map from field to the string sort values
+	sortStrings map[string]*stringColumn
+	// the query cache, nil if disabled
+	cache *queryCache
 }
 
 // AddDoc indexes a document to the searcher. It returns a local doc ID.
 func (s *TokenSetSearcher) AddDoc(fields map[string]stringsp.Set, data interface{}) int32 {
 	docID := int32(len(s.docs))
 	s.docs = append(s.docs, data)
-	if s.inverted == nil {
-		s.inverted = make(map[string][]int32)
-	}
 	for fld, tokens := range fields {
+		if len(tokens) == 0 {
+			continue
+		}
+		id := s.internField(fld)
 		for token := range tokens {
-			key := fld + ":" + token
-			s.inverted[key] = append(s.inverted[key], docID)
+			s.addPosting(id, token, docID)
+		}
+		s.fields[id].addLen(docID, len(tokens))
+	}
+	return docID
+}
+
+// AddDocTokens indexes a document whose fields are represented as sequences
+// of tokens. Different from AddDoc, the frequencies and positions of tokens
+// are also indexed. It returns a local doc ID.
+func (s *TokenSetSearcher) AddDocTokens(fields map[string][]string, data interface{}) int32 {
+	docID := int32(len(s.docs))
+	s.docs = append(s.docs, data)
+	for fld, tokens := range fields {
+		if len(tokens) == 0 {
+			continue
+		}
+		id := s.internField(fld)
+		fi := s.fields[id]
+		tokenPos := make(map[string][]int32)
+		for i, token := range tokens {
+			tokenPos[token] = append(tokenPos[token], int32(i))
+		}
+		for token, pos := range tokenPos {
+			fi.addTokenPositions(token, s.addPosting(id, token, docID), pos)
 		}
+		fi.addLen(docID, len(tokens))
 	}
 	return docID
 }
 
+// DeleteDoc marks a document as deleted. Deleted documents are no longer
+// returned by searching, and their data and index are removed by Compact.
+// ErrInvalidDocID is returned if the doc does not exist or was deleted.
+func (s *TokenSetSearcher) DeleteDoc(docID int32) error {
+	if docID < 0 || docID >= int32(len(s.docs)) || s.isDeleted(docID) {
+		return ErrInvalidDocID
+	}
+	if s.deleted == nil {
+		s.deleted = make(map[int32]bool)
+	}
+	s.deleted[docID] = true
+	return nil
+}
+
+// UpdateDoc replaces a document by deleting it and adding the new one. It
+// returns the local doc ID of the new document.
+func (s *TokenSetSearcher) UpdateDoc(docID int32, fields map[string]stringsp.Set, data interface{}) (int32, error) {
+	if err := s.DeleteDoc(docID); err != nil {
+		return -1, err
+	}
+	return s.AddDoc(fields, data), nil
+}
+
+// isDeleted returns whether the doc was deleted.
+func (s *TokenSetSearcher) isDeleted(docID int32) bool {
+	return s.deleted[docID]
+}
+
+// docOutput returns a func calling output with the data of the doc, skipping
+// deleted docs. Docs loaded lazily are decoded only if not skipped.
+func (s *TokenSetSearcher) docOutput(output func(docID int32, data interface{}) error) func(docID int32) error {
+	return func(docID int32) error {
+		if s.isDeleted(docID) {
+			return nil
+		}
+		data, err := s.doc(docID)
+		if err != nil {
+			return err
+		}
+		return output(docID, data)
+	}
+}
+
+// liveDocs returns the docs in list which are not deleted. list is returned
+// if none is deleted.
+func (s *TokenSetSearcher) liveDocs(list []int32) []int32 {
+	if len(s.deleted) == 0 {
+		return list
+	}
+	live := make([]int32, 0, len(list))
+	for _, docID := range list {
+		if !s.isDeleted(docID) {
+			live = append(live, docID)
+		}
+	}
+	return live
+}
+
+// Compact physically removes the deleted documents. Local doc IDs are
+// reassigned, keeping the order of documents. It returns a slice mapping
+// old local IDs to new ones, with -1 for deleted docs.
+func (s *TokenSetSearcher) Compact() []int32 {
+	newIDs := make([]int32, len(s.docs))
+	docs := make([]interface{}, 0, len(s.docs)-len(s.deleted))
+	for docID := range s.docs {
+		if s.deleted[int32(docID)] {
+			newIDs[docID] = -1
+			continue
+		}
+		newIDs[docID] = int32(len(docs))
+		docs = append(docs, s.docs[docID])
+	}
+	if len(docs) == len(s.docs) {
+		return newIDs
+	}
+	s.docs = docs
+	for _, fi := range s.fields {
+		fi.compact(newIDs)
+	}
+	s.compactNumbers(newIDs)
+	s.compactSortStrings(newIDs)
+	s.deleted = nil
+	if s.cache != nil {
+		s.cache.clear()
+	}
+	return newIDs
+}
+
 // SingleFieldQuery returns a map[strig]stringsp.Set (same type as query int
 // Search method) with a single field.
 func SingleFieldQuery(field string, tokens ...string) map[string]stringsp.Set {
@@ -55,190 +179,589 @@ func SingleFieldQuery(field string, tokens ...string) map[string]stringsp.Set {
 // the search stops, and the error is returned.
 // If no tokens in query, all documents are returned.
 func (s *TokenSetSearcher) Search(query map[string]stringsp.Set, output func(docID int32, data interface{}) error) error {
-	var tokens stringsp.Set
+	outputDoc := s.docOutput(output)
+	var terms []termKey
 	for fld, tks := range query {
+		if len(tks) == 0 {
+			continue
+		}
+		id, ok := s.fieldIDs[fld]
+		if !ok {
+			// no docs have the field, no results
+			return nil
+		}
 		for tk := range tks {
-			key := fld + ":" + tk
-			tokens.Add(key)
+			terms = append(terms, termKey{field: id, token: tk})
 		}
 	}
-	if len(tokens) == 0 {
+	if len(terms) == 0 {
 		// returns all documents
 		for docID := range s.docs {
-			if err := output(int32(docID), s.docs[docID]); err != nil {
+			if err := outputDoc(int32(docID)); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
-	if len(tokens) == 1 {
-		// for single token, iterating over the inverted list
-		for token := range tokens {
-			for _, docID := range s.inverted[token] {
-				if err := output(docID, s.docs[docID]); err != nil {
+	if docs, ok := s.cachedIntersection(terms); ok {
+		return intersectDocs([]docIterator{newSliceIterator(docs)}, outputDoc)
+	}
+	iters := make([]docIterator, 0, len(terms))
+	for _, t := range terms {
+		l := s.fields[t.field].inverted[t.token]
+		if l.len() == 0 {
+			// one of the inverted is empty, no results
+			return nil
+		}
+		iters = append(iters, l.iterator())
+	}
+	return intersectDocs(iters, outputDoc)
+}
+
+// Save serializes the searcher data to a Writer. The data start with a header
+// of magic bytes and the format version, followed by sections of gob streams,
+// each with a CRC32 checksum.
+func (s *TokenSetSearcher) Save(w io.Writer) error {
+	if err := writeHeader(w, searcherMagic, searcherFormatVersion); err != nil {
+		return err
+	}
+	// docs are encoded independently so that they can be decoded lazily.
+	if err := writeSection(w, func(enc *gob.Encoder) error {
+		if err := enc.Encode(len(s.docs)); err != nil {
+			return err
+		}
+		for _, data := range s.docs {
+			bs, ok := data.(lazyDoc)
+			if !ok {
+				var err error
+				if bs, err = encodeDoc(data); err != nil {
 					return err
 				}
 			}
+			if err := enc.Encode(bs); err != nil {
+				return err
+			}
 		}
 		return nil
+	}); err != nil {
+		return err
 	}
-	N, n := len(s.docs), len(tokens)
-	if N == 0 {
-		return nil
+	// inverted lists and positions are saved field by field, each section
+	// starting with the total number of tokens and the number of fields.
+	if err := writeSection(w, func(enc *gob.Encoder) error {
+		return s.encodeFields(enc, func(fi *fieldIndex) int {
+			return len(fi.inverted)
+		}, func(fi *fieldIndex) error {
+			for token, l := range fi.inverted {
+				if err := enc.Encode(token); err != nil {
+					return err
+				}
+				if err := enc.Encode(l.n); err != nil {
+					return err
+				}
+				if err := enc.Encode(l.data); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}); err != nil {
+		return err
 	}
-	mnI := 0
-	invLists := make([][]int32, 0, n)
-	for token := range tokens {
-		list := s.inverted[token]
-		if len(list) == 0 {
-			// one of the inverted is empty, no results
+	if err := writeSection(w, func(enc *gob.Encoder) error {
+		return s.encodeFields(enc, func(fi *fieldIndex) int {
+			return len(fi.positions)
+		}, func(fi *fieldIndex) error {
+			for token, poss := range fi.positions {
+				if err := enc.Encode(token); err != nil {
+					return err
+				}
+				if err := enc.Encode(poss); err != nil {
+					return err
+				}
+			}
 			return nil
+		})
+	}); err != nil {
+		return err
+	}
+	if err := writeSection(w, func(enc *gob.Encoder) error {
+		deleted := make([]int32, 0, len(s.deleted))
+		for docID := range s.deleted {
+			deleted = append(deleted, docID)
+		}
+		return enc.Encode(deleted)
+	}); err != nil {
+		return err
+	}
+	if err := writeSection(w, func(enc *gob.Encoder) error {
+		if err := enc.Encode(len(s.numbers)); err != nil {
+			return err
+		}
+		for fld, idx := range s.numbers {
+			docIDs, keys := idx.entries()
+			if err := enc.Encode(fld); err != nil {
+				return err
+			}
+			if err := enc.Encode(idx.isFloat); err != nil {
+				return err
+			}
+			if err := enc.Encode(docIDs); err != nil {
+				return err
+			}
+			if err := enc.Encode(keys); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return writeSection(w, func(enc *gob.Encoder) error {
+		if err := enc.Encode(len(s.sortStrings)); err != nil {
+			return err
+		}
+		for fld, col := range s.sortStrings {
+			var docIDs []int32
+			var values []string
+			for docID, has := range col.has {
+				if has {
+					docIDs, values = append(docIDs, int32(docID)), append(values, col.values[docID])
+				}
+			}
+			if err := enc.Encode(fld); err != nil {
+				return err
+			}
+			if err := enc.Encode(docIDs); err != nil {
+				return err
+			}
+			if err := enc.Encode(values); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Load restores the searcher data from a Reader. ErrChecksumMismatch is
+// returned if the data are corrupted, and ErrUnsupportedVersion if they were
+// saved in an unsupported format version. Headerless data saved by older
+// versions can also be loaded.
+func (s *TokenSetSearcher) Load(r io.Reader) error {
+	return s.LoadWithOptions(r, LoadOptions{})
+}
+
+// LoadWithOptions is Load with options limiting the counts in the data,
+// decoding docs lazily, and reporting the progress. ErrLimitExceeded is
+// returned if a count is out of the limits.
+//
+// Memory is never allocated in advance according to counts in the data beyond
+// a small size, so corrupted counts fail with an error instead of allocating
+// huge memory.
+func (s *TokenSetSearcher) LoadWithOptions(r io.Reader, opts LoadOptions) error {
+	cache := s.cache
+	*s = TokenSetSearcher{cache: cache}
+	if cache != nil {
+		cache.clear()
+	}
+
+	ld := &loader{opts: opts, cr: &countingReader{r: r}}
+	br := bufio.NewReader(ld.cr)
+	version, ok, err := readHeader(br, searcherMagic)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return s.loadHeaderless(br, ld)
+	}
+	if version != searcherFormatVersion {
+		return ErrUnsupportedVersion
+	}
+
+	if err := readSection(br, func(dec *gob.Decoder) error {
+		var docsLen int
+		if err := dec.Decode(&docsLen); err != nil {
+			return err
+		}
+		if err := checkCount(docsLen, opts.MaxDocs); err != nil {
+			return err
 		}
-		invLists = append(invLists, list)
-		if len(list) < len(invLists[mnI]) {
-			mnI = len(invLists) - 1
-		}
-	}
-	// mnI1 is the index next to mnI
-	mnI1 := (mnI + 1) % n
-	// gaps is the minimum difference of docID that may cause a skip
-	gaps := make([]int32, n)
-	for i := range invLists {
-		gaps[i] = 2 * int32(N) / int32(len(invLists[i]))
-	}
-	// the current indexes in inverted lists
-	idxs := make([]int, n)
-
-	docID, matched, i := invLists[mnI][0], 1, mnI1
-mainloop:
-	for {
-		invList := invLists[i]
-
-		if docID-invList[idxs[i]] > gaps[i] {
-			// estimate skip linearly
-			skip := int64(docID-invList[idxs[i]]) * int64(len(invList)) / int64(N)
-			newIdx := idxs[i] + int(skip)
-			if newIdx < len(invList) && invList[newIdx] <= docID {
-				idxs[i] = newIdx
-			}
-		}
-		// search for docID
-		for invList[idxs[i]] < docID {
-			idxs[i]++
-			if idxs[i] == len(invList) {
-				// no more docs in invLists[i]
-				break mainloop
-			}
-		}
-		if invList[idxs[i]] > docID {
-			// move to next docID in mnI list
-			idxs[mnI]++
-			if idxs[mnI] == len(invLists[mnI]) {
-				break mainloop
-			}
-			docID, matched, i = invLists[mnI][idxs[mnI]], 1, mnI1
-		} else {
-			matched++
-			if matched == n {
-				// found a document
-				err := output(docID, s.docs[docID])
+		s.docs = make([]interface{}, 0, preallocLen(docsLen))
+		for i := 0; i < docsLen; i++ {
+			var bs []byte
+			if err := dec.Decode(&bs); err != nil {
+				return err
+			}
+			if opts.LazyDocs {
+				s.docs = append(s.docs, lazyDoc(bs))
+			} else {
+				data, err := decodeDoc(bs)
 				if err != nil {
 					return err
 				}
-				// move to next docID in mnI list
-				idxs[mnI]++
-				if idxs[mnI] == len(invLists[mnI]) {
-					break mainloop
+				s.docs = append(s.docs, data)
+			}
+			ld.progress("docs", i+1, docsLen)
+		}
+		ld.done("docs", docsLen)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := s.loadFieldSections(br, ld); err != nil {
+		return err
+	}
+	var deleted []int32
+	if err := readSection(br, func(dec *gob.Decoder) error {
+		return dec.Decode(&deleted)
+	}); err != nil {
+		return err
+	}
+	ld.done("deleted", len(deleted))
+	if err := readSection(br, func(dec *gob.Decoder) error {
+		var numLen int
+		if err := dec.Decode(&numLen); err != nil {
+			return err
+		}
+		if err := checkCount(numLen, opts.MaxTerms); err != nil {
+			return err
+		}
+		for i := 0; i < numLen; i++ {
+			var fld string
+			var isFloat bool
+			var docIDs []int32
+			var keys []uint64
+			if err := dec.Decode(&fld); err != nil {
+				return err
+			}
+			if err := dec.Decode(&isFloat); err != nil {
+				return err
+			}
+			if err := dec.Decode(&docIDs); err != nil {
+				return err
+			}
+			if err := dec.Decode(&keys); err != nil {
+				return err
+			}
+			if len(keys) != len(docIDs) {
+				return ErrLimitExceeded
+			}
+			for _, docID := range docIDs {
+				if docID < 0 || int(docID) >= len(s.docs) {
+					return ErrLimitExceeded
 				}
-				docID, matched, i = invLists[mnI][idxs[mnI]], 1, mnI1
-			} else {
-				i++
-				if i == n {
-					i = 0
+			}
+			if s.numbers == nil {
+				s.numbers = make(map[string]*numericIndex)
+			}
+			s.numbers[fld] = newNumericIndex(isFloat, docIDs, keys)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	ld.done("numbers", len(s.numbers))
+	if err := readSection(br, func(dec *gob.Decoder) error {
+		var colLen int
+		if err := dec.Decode(&colLen); err != nil {
+			return err
+		}
+		if err := checkCount(colLen, opts.MaxTerms); err != nil {
+			return err
+		}
+		for i := 0; i < colLen; i++ {
+			var fld string
+			var docIDs []int32
+			var values []string
+			if err := dec.Decode(&fld); err != nil {
+				return err
+			}
+			if err := dec.Decode(&docIDs); err != nil {
+				return err
+			}
+			if err := dec.Decode(&values); err != nil {
+				return err
+			}
+			if len(values) != len(docIDs) {
+				return ErrLimitExceeded
+			}
+			for j, docID := range docIDs {
+				if err := s.SetSortString(docID, fld, values[j]); err != nil {
+					return ErrLimitExceeded
 				}
 			}
 		}
+		return nil
+	}); err != nil {
+		return err
 	}
-	return nil
+	ld.done("columns", len(s.sortStrings))
+	return s.finishLoad(deleted)
 }
 
-// Save serializes the searcher data to a Writer with the gob encoder.
-func (s *TokenSetSearcher) Save(w io.Writer) error {
-	enc := gob.NewEncoder(w)
-
-	if err := enc.Encode(len(s.docs)); err != nil {
+// loadFieldSections loads the sections of inverted lists and positions saved
+// field by field.
+func (s *TokenSetSearcher) loadFieldSections(br *bufio.Reader, ld *loader) error {
+	if err := readSection(br, func(dec *gob.Decoder) error {
+		total, err := s.decodeFields(dec, ld.opts.MaxTerms, func(fi *fieldIndex, loaded, total int) error {
+			var token string
+			l := &postingList{}
+			if err := dec.Decode(&token); err != nil {
+				return err
+			}
+			if err := dec.Decode(&l.n); err != nil {
+				return err
+			}
+			// empty lists are never saved
+			if l.n == 0 {
+				return ErrLimitExceeded
+			}
+			if err := checkCount(l.n, len(s.docs)); err != nil {
+				return err
+			}
+			if err := dec.Decode(&l.data); err != nil {
+				return err
+			}
+			// every docID takes at least one byte
+			if len(l.data) < l.n {
+				return ErrLimitExceeded
+			}
+			fi.inverted[token] = l
+			ld.progress("inverted", loaded, total)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		ld.done("inverted", total)
+		return nil
+	}); err != nil {
 		return err
 	}
-	for i := range s.docs {
-		if err := enc.Encode(&s.docs[i]); err != nil {
+	return readSection(br, func(dec *gob.Decoder) error {
+		total, err := s.decodeFields(dec, ld.opts.MaxTerms, func(fi *fieldIndex, loaded, total int) error {
+			var token string
+			var poss [][]int32
+			if err := dec.Decode(&token); err != nil {
+				return err
+			}
+			if err := dec.Decode(&poss); err != nil {
+				return err
+			}
+			if fi.positions == nil {
+				fi.positions = make(map[string][][]int32)
+			}
+			fi.positions[token] = poss
+			ld.progress("positions", loaded, total)
+			return nil
+		})
+		if err != nil {
 			return err
 		}
+		ld.done("positions", total)
+		return nil
+	})
+}
+
+// encodeFields encodes the total number of items of all fields, and the
+// number of fields with items, followed by the name and the number of items
+// of each of them, and the items encoded by encode.
+func (s *TokenSetSearcher) encodeFields(enc *gob.Encoder, count func(fi *fieldIndex) int, encode func(fi *fieldIndex) error) error {
+	total, n := 0, 0
+	for _, fi := range s.fields {
+		if c := count(fi); c > 0 {
+			total, n = total+c, n+1
+		}
+	}
+	if err := enc.Encode(total); err != nil {
+		return err
 	}
-	if err := enc.Encode(len(s.inverted)); err != nil {
+	if err := enc.Encode(n); err != nil {
 		return err
 	}
-	for token, ids := range s.inverted {
-		if err := enc.Encode(token); err != nil {
+	for _, fi := range s.fields {
+		c := count(fi)
+		if c == 0 {
+			continue
+		}
+		if err := enc.Encode(fi.name); err != nil {
+			return err
+		}
+		if err := enc.Encode(c); err != nil {
 			return err
 		}
-		if err := enc.Encode(ids); err != nil {
+		if err := encode(fi); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// Load restores the searcher data from a Reader with the gob decoder.
-func (s *TokenSetSearcher) Load(r io.Reader) error {
-	*s = TokenSetSearcher{}
+// decodeFields decodes the data encoded by encodeFields, calling decode for
+// each item with the number of loaded items, including it. The total number of
+// items is checked against max, and returned.
+func (s *TokenSetSearcher) decodeFields(dec *gob.Decoder, max int, decode func(fi *fieldIndex, loaded, total int) error) (int, error) {
+	var total, n int
+	if err := dec.Decode(&total); err != nil {
+		return 0, err
+	}
+	if err := checkCount(total, max); err != nil {
+		return 0, err
+	}
+	if err := dec.Decode(&n); err != nil {
+		return 0, err
+	}
+	if n < 0 || n > total {
+		return 0, ErrLimitExceeded
+	}
+	loaded := 0
+	for i := 0; i < n; i++ {
+		var name string
+		var cnt int
+		if err := dec.Decode(&name); err != nil {
+			return 0, err
+		}
+		if err := dec.Decode(&cnt); err != nil {
+			return 0, err
+		}
+		if cnt < 0 || cnt > total-loaded {
+			return 0, ErrLimitExceeded
+		}
+		fi := s.fields[s.internField(name)]
+		for j := 0; j < cnt; j++ {
+			loaded++
+			if err := decode(fi, loaded, total); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if loaded != total {
+		return 0, ErrLimitExceeded
+	}
+	return total, nil
+}
 
+// loadHeaderless loads data saved before the header was introduced, i.e. a
+// single gob stream.
+func (s *TokenSetSearcher) loadHeaderless(r io.Reader, ld *loader) error {
 	dec := gob.NewDecoder(r)
 
 	var docsLen int
 	if err := dec.Decode(&docsLen); err != nil {
 		return err
 	}
-	s.docs = make([]interface{}, docsLen)
+	if err := checkCount(docsLen, ld.opts.MaxDocs); err != nil {
+		return err
+	}
+	s.docs = make([]interface{}, 0, preallocLen(docsLen))
 	for i := 0; i < docsLen; i++ {
-		if err := dec.Decode(&s.docs[i]); err != nil {
+		var data interface{}
+		if err := dec.Decode(&data); err != nil {
 			return err
 		}
+		s.docs = append(s.docs, data)
+		ld.progress("docs", i+1, docsLen)
 	}
+	ld.done("docs", docsLen)
 	var invLen int
 	if err := dec.Decode(&invLen); err != nil {
 		return err
 	}
-	if invLen > 0 {
-		s.inverted = make(map[string][]int32)
-		for i := 0; i < invLen; i++ {
-			var token string
-			var ids []int32
-			if err := dec.Decode(&token); err != nil {
-				return err
-			}
-			if err := dec.Decode(&ids); err != nil {
-				return err
+	if err := checkCount(invLen, ld.opts.MaxTerms); err != nil {
+		return err
+	}
+	inverted := make(map[string]*postingList)
+	for i := 0; i < invLen; i++ {
+		var token string
+		var ids []int32
+		if err := dec.Decode(&token); err != nil {
+			return err
+		}
+		if err := dec.Decode(&ids); err != nil {
+			return err
+		}
+		inverted[token] = newPostingList(ids)
+		ld.progress("inverted", i+1, invLen)
+	}
+	ld.done("inverted", invLen)
+	s.importKeys(inverted)
+	return s.finishLoad(nil)
+}
+
+// finishLoad validates the docIDs of the inverted lists, marks deleted docs
+// and rebuilds the data not saved after docs, inverted lists and positions are
+// loaded. ErrInvalidDocID is returned if a docID is out of range.
+func (s *TokenSetSearcher) finishLoad(deleted []int32) error {
+	for _, fi := range s.fields {
+		for _, l := range fi.inverted {
+			if !l.buildIndex(len(s.docs)) {
+				return ErrInvalidDocID
 			}
-			s.inverted[token] = ids
 		}
 	}
+	for _, docID := range deleted {
+		if err := s.DeleteDoc(docID); err != nil {
+			return err
+		}
+	}
+	for _, fi := range s.fields {
+		fi.rebuildTerms()
+		// lengths of fields are not saved, rebuild them from inverted lists.
+		fi.rebuildLens()
+	}
 	return nil
 }
 
-// DocInfo returns the doc-info of specified doc
+// DocInfo returns the doc-info of specified doc. If the doc was loaded lazily
+// and fails to be decoded, the error is returned.
 func (s *TokenSetSearcher) DocInfo(docID int32) interface{} {
-	if docID < 0 || docID >= int32(len(s.docs)) {
+	if docID < 0 || docID >= int32(len(s.docs)) || s.isDeleted(docID) {
 		return ErrInvalidDocID
 	}
-	return s.docs[docID]
+	data, err := s.doc(docID)
+	if err != nil {
+		return err
+	}
+	return data
 }
 
-// DocCount returns the number of docs.
+// DocCount returns the number of docs, excluding deleted ones.
 func (s *TokenSetSearcher) DocCount() int {
-	return len(s.docs)
+	return len(s.docs) - len(s.deleted)
 }
 
 // Returns the docIDs of a speicified token.
 func (s *TokenSetSearcher) TokenDocList(field, token string) []int32 {
-	return s.inverted[field+":"+token]
+	return s.postings(field, token).docIDs()
+}
+
+// Posting is an element of the inverted list of a token.
+type Posting struct {
+	DocID int32
+	// Freq is the number of occurrences of the token in the field.
+	Freq int
+	// Positions are the indexes of the token in the field. It is nil if the
+	// doc was added by AddDoc.
+	Positions []int32
+}
+
+// TokenPostings returns the postings of a specified token, in the same order
+// as TokenDocList.
+//
+// NOTE Do NOT change the elements of Positions
+func (s *TokenSetSearcher) TokenPostings(field, token string) []Posting {
+	fi := s.field(field)
+	l := fi.postings(token)
+	if l.len() == 0 {
+		return nil
+	}
+	postings := make([]Posting, 0, l.n)
+	for it := l.iterator(); it.next(); {
+		postings = append(postings, Posting{
+			DocID:     it.docID(),
+			Freq:      fi.termFreq(token, it.idx),
+			Positions: fi.tokenPositions(token, it.idx),
+		})
+	}
+	return postings
 }
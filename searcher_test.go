@@ -255,3 +255,215 @@ func TestTokenSetSearcher_bug1(t *testing.T) {
 	sch.Search(SingleFieldQuery("text", "c", "b"), collector)
 	assert.StringEqual(t, "docs", docs, "[0 4]")
 }
+
+func TestTokenSetSearcher_AddDocTokens(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	sch.AddDoc(map[string]stringsp.Set{"text": stringsp.NewSet("go", "http")}, 0)
+	sch.AddDocTokens(map[string][]string{"text": {"go", "http", "go"}}, 1)
+	sch.AddDocTokens(map[string][]string{"text": {"http", "server"}}, 2)
+
+	assert.StringEqual(t, "go", sch.TokenDocList("text", "go"), "[0 1]")
+	assert.Equal(t, "go", sch.TokenPostings("text", "go"), []Posting{
+		{DocID: 0, Freq: 1},
+		{DocID: 1, Freq: 2, Positions: []int32{0, 2}},
+	})
+	assert.Equal(t, "http", sch.TokenPostings("text", "http"), []Posting{
+		{DocID: 0, Freq: 1},
+		{DocID: 1, Freq: 1, Positions: []int32{1}},
+		{DocID: 2, Freq: 1, Positions: []int32{0}},
+	})
+	assert.Equal(t, "fieldLen", sch.field("text").docLen(1), int32(3))
+
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.NoErrorOrDie(t, sch.Load(&b))
+	assert.Equal(t, "go", sch.TokenPostings("text", "go"), []Posting{
+		{DocID: 0, Freq: 1},
+		{DocID: 1, Freq: 2, Positions: []int32{0, 2}},
+	})
+	assert.Equal(t, "fieldLen", sch.field("text").docLen(1), int32(3))
+	assert.Equal(t, "fieldLenSums", sch.field("text").lenSum, int64(7))
+}
+
+func TestTokenSetSearcher_DeleteDoc(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	sch.AddDoc(map[string]stringsp.Set{"text": stringsp.NewSet("a", "b")}, "0")
+	sch.AddDocTokens(map[string][]string{"text": {"a", "c", "a"}}, "1")
+	sch.AddDocTokens(map[string][]string{"text": {"b", "a"}}, "2")
+
+	searchDocs := func(query map[string]stringsp.Set) []int32 {
+		var docs []int32
+		assert.NoError(t, sch.Search(query, func(docID int32, data interface{}) error {
+			docs = append(docs, docID)
+			return nil
+		}))
+		return docs
+	}
+
+	assert.NoError(t, sch.DeleteDoc(0))
+	assert.Equal(t, "DeleteDoc(0)", sch.DeleteDoc(0), ErrInvalidDocID)
+	assert.Equal(t, "DeleteDoc(3)", sch.DeleteDoc(3), ErrInvalidDocID)
+	assert.Equal(t, "DocCount", sch.DocCount(), 2)
+	assert.Equal(t, "DocInfo(0)", sch.DocInfo(0), ErrInvalidDocID)
+	assert.StringEqual(t, "all", searchDocs(nil), "[1 2]")
+	assert.StringEqual(t, "a", searchDocs(SingleFieldQuery("text", "a")), "[1 2]")
+	assert.StringEqual(t, "a b", searchDocs(SingleFieldQuery("text", "a", "b")), "[2]")
+	assert.StringEqual(t, "-c", searchQueryDocs(t, sch, Not{Term{"text", "c"}}), "[2]")
+
+	newID, err := sch.UpdateDoc(2, map[string]stringsp.Set{"text": stringsp.NewSet("c")}, "3")
+	assert.NoError(t, err)
+	assert.Equal(t, "newID", newID, int32(3))
+	assert.StringEqual(t, "c", searchDocs(SingleFieldQuery("text", "c")), "[1 3]")
+	assert.StringEqual(t, "b", searchDocs(SingleFieldQuery("text", "b")), "[]")
+
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.NoErrorOrDie(t, sch.Load(&b))
+	assert.Equal(t, "DocCount", sch.DocCount(), 2)
+	assert.StringEqual(t, "c", searchDocs(SingleFieldQuery("text", "c")), "[1 3]")
+
+	assert.StringEqual(t, "Compact", sch.Compact(), "[-1 0 -1 1]")
+	assert.Equal(t, "DocCount", sch.DocCount(), 2)
+	assert.Equal(t, "DocInfo(1)", sch.DocInfo(1), "3")
+	assert.StringEqual(t, "all", searchDocs(nil), "[0 1]")
+	assert.StringEqual(t, "c", searchDocs(SingleFieldQuery("text", "c")), "[0 1]")
+	assert.StringEqual(t, "b", sch.TokenDocList("text", "b"), "[]")
+	assert.Equal(t, "a", sch.TokenPostings("text", "a"), []Posting{
+		{DocID: 0, Freq: 2, Positions: []int32{0, 2}},
+	})
+	assert.Equal(t, "c", sch.TokenPostings("text", "c"), []Posting{
+		{DocID: 0, Freq: 1, Positions: []int32{1}},
+		{DocID: 1, Freq: 1},
+	})
+	assert.Equal(t, "fieldLenSums", sch.field("text").lenSum, int64(4))
+}
+
+// gapIntersection intersects sorted inverted lists with the algorithm used
+// before skip pointers, i.e. estimating skips linearly from a gap heuristic
+// and otherwise walking one posting at a time. N is the number of docs.
+func gapIntersection(N int, invLists [][]int32, output func(docID int32)) {
+	n, mnI := len(invLists), 0
+	for i := range invLists {
+		if len(invLists[i]) < len(invLists[mnI]) {
+			mnI = i
+		}
+	}
+	// mnI1 is the index next to mnI
+	mnI1 := (mnI + 1) % n
+	// gaps is the minimum difference of docID that may cause a skip
+	gaps := make([]int32, n)
+	for i := range invLists {
+		gaps[i] = 2 * int32(N) / int32(len(invLists[i]))
+	}
+	// the current indexes in inverted lists
+	idxs := make([]int, n)
+
+	docID, matched, i := invLists[mnI][0], 1, mnI1
+	for {
+		invList := invLists[i]
+
+		if docID-invList[idxs[i]] > gaps[i] {
+			// estimate skip linearly
+			skip := int64(docID-invList[idxs[i]]) * int64(len(invList)) / int64(N)
+			newIdx := idxs[i] + int(skip)
+			if newIdx < len(invList) && invList[newIdx] <= docID {
+				idxs[i] = newIdx
+			}
+		}
+		// search for docID
+		for invList[idxs[i]] < docID {
+			idxs[i]++
+			if idxs[i] == len(invList) {
+				// no more docs in invLists[i]
+				return
+			}
+		}
+		if invList[idxs[i]] > docID || matched+1 == n {
+			if invList[idxs[i]] == docID {
+				// found a document
+				output(docID)
+			}
+			// move to next docID in mnI list
+			idxs[mnI]++
+			if idxs[mnI] == len(invLists[mnI]) {
+				return
+			}
+			docID, matched, i = invLists[mnI][idxs[mnI]], 1, mnI1
+		} else {
+			matched++
+			if i++; i == n {
+				i = 0
+			}
+		}
+	}
+}
+
+func TestGapIntersection(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 100; n++ {
+		var invLists [][]int32
+		var iters []docIterator
+		for i := 0; i < 3; i++ {
+			var l []int32
+			for docID := int32(0); docID < 200; docID++ {
+				if rnd.Intn(i*5+2) == 0 {
+					l = append(l, docID)
+				}
+			}
+			if len(l) == 0 {
+				l = append(l, 0)
+			}
+			invLists = append(invLists, l)
+			iters = append(iters, newPostingList(l).iterator())
+		}
+		var exp, act []int32
+		intersectDocs(iters, func(docID int32) error {
+			exp = append(exp, docID)
+			return nil
+		})
+		gapIntersection(200, invLists, func(docID int32) {
+			act = append(act, docID)
+		})
+		assert.Equal(t, "docs", act, exp)
+	}
+}
+
+// zipfSearcher returns a searcher with docs of tokens in Zipfian distribution,
+// where token "0" is the most common one.
+func zipfSearcher() *TokenSetSearcher {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, 10000)
+	sch := &TokenSetSearcher{}
+	for i := 0; i < 100000; i++ {
+		var tokens stringsp.Set
+		for j := 0; j < 10; j++ {
+			tokens.Add(fmt.Sprint(zipf.Uint64()))
+		}
+		sch.AddDoc(map[string]stringsp.Set{"text": tokens}, i)
+	}
+	return sch
+}
+
+// BenchmarkZipfIntersection_GapHeuristic intersects the uncompressed lists of
+// a very common token and a rare token with the algorithm used before skip
+// pointers.
+func BenchmarkZipfIntersection_GapHeuristic(b *testing.B) {
+	sch := zipfSearcher()
+	invLists := [][]int32{sch.TokenDocList("text", "0"), sch.TokenDocList("text", "500")}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gapIntersection(len(sch.docs), invLists, func(int32) {})
+	}
+}
+
+// BenchmarkZipfIntersection_Skips intersects the compressed lists of the same
+// tokens with skip pointers and galloping.
+func BenchmarkZipfIntersection_Skips(b *testing.B) {
+	sch := zipfSearcher()
+	common, rare := sch.postings("text", "0"), sch.postings("text", "500")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intersectDocs([]docIterator{common.iterator(), rare.iterator()}, func(int32) error {
+			return nil
+		})
+	}
+}
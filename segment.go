@@ -0,0 +1,729 @@
+package index
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golangplus/errors"
+	"github.com/golangplus/strings"
+)
+
+const (
+	// the manifest file listing the segments of a SegmentedIndex
+	siManifestFilename = "segments"
+	// the file of the global IDs of the docs in a segment
+	siIDsFilename = "ids"
+	// the file of the docs deleted after a segment was written
+	siDeletesFilename = "deletes"
+	// the prefix of the directory names of segments
+	siSegmentPrefix = "seg-"
+
+	// default values of SegmentOptions
+	DefaultFlushDocs   = 10000
+	DefaultMergeFactor = 10
+)
+
+var (
+	// error of modifying a SegmentedIndex after it is closed
+	ErrIndexClosed = errors.New("Index closed")
+)
+
+// SegmentOptions are options of a SegmentedIndex.
+type SegmentOptions struct {
+	// The in-memory segment is flushed to the disk when it contains FlushDocs
+	// docs. Zero means DefaultFlushDocs.
+	FlushDocs int
+	// When there are at least MergeFactor on-disk segments, MergeFactor
+	// adjacent segments with the smallest total number of docs are merged in
+	// the background. Zero means DefaultMergeFactor.
+	MergeFactor int
+}
+
+// siManifest is saved in the manifest file of a SegmentedIndex.
+type siManifest struct {
+	// the global ID of the next doc
+	NextID int64
+	// the number in the name of the next segment
+	NextSegment int
+	// names of segments in the order of global IDs
+	Segments []string
+}
+
+// SegmentedIndex is an index of docs in segments. New docs are added to an
+// in-memory segment, which is flushed to an immutable on-disk segment in the
+// format of DiskTokenSetSearcher when it is big enough. Small on-disk segments
+// are merged in the background, removing deleted docs.
+//
+// Docs are identified by global IDs, which are never changed by merging.
+// Searching spans all segments.
+//
+// Docs in the in-memory segment are lost if the index is not closed or
+// flushed. A SegmentedIndex is safe for concurrent use. The output functions
+// of searching methods must not call modifying methods.
+type SegmentedIndex struct {
+	dir  string
+	opts SegmentOptions
+
+	mu sync.RWMutex
+	// the in-memory segment, with docs of global IDs from memBase
+	mem     TokenSetSearcher
+	memBase int64
+	// on-disk segments in the order of global IDs
+	segs        []*segment
+	nextID      int64
+	nextSegment int
+
+	// serializes merges
+	mergeMu sync.Mutex
+	// signals the background merger
+	mergeCh chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+	// the error of the last failed background merge
+	mergeErr error
+	// set by Close, after which no merges are started and modifying methods
+	// fail
+	closed bool
+	// if not nil, called after each round of background merging
+	onMerged func()
+}
+
+// segment is an on-disk segment of a SegmentedIndex.
+type segment struct {
+	name string
+	ds   *DiskTokenSetSearcher
+	// global IDs of the docs, increasing
+	globalIDs []int64
+	// docs deleted after the segment was written
+	deleted map[int32]bool
+	// whether deleted was changed after saved
+	dirty bool
+}
+
+// isDeleted returns whether a local doc was deleted.
+func (seg *segment) isDeleted(docID int32) bool {
+	return seg.ds.deleted[docID] || seg.deleted[docID]
+}
+
+// OpenSegmentedIndex opens a SegmentedIndex in dir, which is created if not
+// existing. If opts is nil, default options are used.
+func OpenSegmentedIndex(dir string, opts *SegmentOptions) (*SegmentedIndex, error) {
+	si := &SegmentedIndex{
+		dir:     dir,
+		mergeCh: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if opts != nil {
+		si.opts = *opts
+	}
+	if si.opts.FlushDocs <= 0 {
+		si.opts.FlushDocs = DefaultFlushDocs
+	}
+	if si.opts.MergeFactor <= 1 {
+		si.opts.MergeFactor = DefaultMergeFactor
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errorsp.WithStacks(err)
+	}
+	var manifest siManifest
+	if err := readGobFile(path.Join(dir, siManifestFilename), &manifest); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := removeUnlistedSegments(dir, manifest.Segments); err != nil {
+		return nil, err
+	}
+	for _, name := range manifest.Segments {
+		seg, err := si.openSegment(name)
+		if err != nil {
+			si.closeSegments()
+			return nil, err
+		}
+		si.segs = append(si.segs, seg)
+	}
+	si.nextID, si.memBase = manifest.NextID, manifest.NextID
+	si.nextSegment = manifest.NextSegment
+
+	si.wg.Add(1)
+	go si.mergeLoop()
+	return si, nil
+}
+
+// removeUnlistedSegments removes the directories of segments in dir not in
+// names, which were left by a crash in the middle of flushing or merging.
+func removeUnlistedSegments(dir string, names []string) error {
+	listed := stringsp.NewSet(names...)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return errorsp.WithStacks(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), siSegmentPrefix) && !listed.Contain(e.Name()) {
+			if err := os.RemoveAll(path.Join(dir, e.Name())); err != nil {
+				return errorsp.WithStacks(err)
+			}
+		}
+	}
+	return nil
+}
+
+func (si *SegmentedIndex) openSegment(name string) (*segment, error) {
+	segDir := path.Join(si.dir, name)
+	seg := &segment{name: name, deleted: make(map[int32]bool)}
+	if err := readGobFile(path.Join(segDir, siIDsFilename), &seg.globalIDs); err != nil {
+		return nil, err
+	}
+	var deleted []int32
+	if err := readGobFile(path.Join(segDir, siDeletesFilename), &deleted); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, docID := range deleted {
+		seg.deleted[docID] = true
+	}
+	ds, err := OpenDiskTokenSetSearcher(segDir)
+	if err != nil {
+		return nil, err
+	}
+	seg.ds = ds
+	return seg, nil
+}
+
+// Close stops the background merger, waits for running merges, flushes the
+// in-memory segment, and closes the on-disk segments. The error of the last
+// failed background merge, if any, is returned. Modifying methods fail with
+// ErrIndexClosed after Close, and closing again does nothing.
+func (si *SegmentedIndex) Close() error {
+	si.mu.Lock()
+	if si.closed {
+		si.mu.Unlock()
+		return nil
+	}
+	si.closed = true
+	si.mu.Unlock()
+
+	close(si.done)
+	si.wg.Wait()
+	// waits for a merge started by Merge
+	si.mergeMu.Lock()
+	defer si.mergeMu.Unlock()
+
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	err := si.flushLocked()
+	if e := si.closeSegments(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = si.mergeErr
+	}
+	return err
+}
+
+func (si *SegmentedIndex) closeSegments() error {
+	var err error
+	for _, seg := range si.segs {
+		if e := seg.ds.Close(); e != nil {
+			err = e
+		}
+	}
+	si.segs = nil
+	return err
+}
+
+// AddDoc adds a doc to the in-memory segment, and returns the global ID. If
+// the in-memory segment becomes big enough, it is flushed and the error of
+// flushing is returned.
+func (si *SegmentedIndex) AddDoc(fields map[string]stringsp.Set, data interface{}) (int64, error) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	if si.closed {
+		return -1, ErrIndexClosed
+	}
+	docID := si.nextID
+	si.mem.AddDoc(fields, data)
+	si.nextID++
+	if len(si.mem.docs) >= si.opts.FlushDocs {
+		if err := si.flushLocked(); err != nil {
+			return docID, err
+		}
+	}
+	return docID, nil
+}
+
+// locate returns the on-disk segment and the local ID of a global ID. A nil
+// segment with a local ID >= 0 is returned if the doc is in the in-memory
+// segment, and a local ID of -1 if the doc does not exist.
+func (si *SegmentedIndex) locate(docID int64) (*segment, int32) {
+	if docID < 0 || docID >= si.nextID {
+		return nil, -1
+	}
+	if docID >= si.memBase {
+		return nil, int32(docID - si.memBase)
+	}
+	i := sort.Search(len(si.segs), func(i int) bool {
+		ids := si.segs[i].globalIDs
+		return ids[len(ids)-1] >= docID
+	})
+	if i == len(si.segs) {
+		return nil, -1
+	}
+	seg := si.segs[i]
+	j := sort.Search(len(seg.globalIDs), func(j int) bool {
+		return seg.globalIDs[j] >= docID
+	})
+	if seg.globalIDs[j] != docID {
+		return nil, -1
+	}
+	return seg, int32(j)
+}
+
+// DeleteDoc deletes a doc by the global ID. ErrInvalidDocID is returned if
+// the doc does not exist or was deleted. Deletions in on-disk segments are
+// saved when flushing.
+func (si *SegmentedIndex) DeleteDoc(docID int64) error {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	if si.closed {
+		return ErrIndexClosed
+	}
+	seg, localID := si.locate(docID)
+	if localID < 0 {
+		return ErrInvalidDocID
+	}
+	if seg == nil {
+		return si.mem.DeleteDoc(localID)
+	}
+	if seg.isDeleted(localID) {
+		return ErrInvalidDocID
+	}
+	seg.deleted[localID] = true
+	seg.dirty = true
+	return nil
+}
+
+// DocInfo returns the data of a doc by the global ID. ErrInvalidDocID is
+// returned if the doc does not exist or was deleted.
+func (si *SegmentedIndex) DocInfo(docID int64) (interface{}, error) {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+
+	seg, localID := si.locate(docID)
+	if localID < 0 {
+		return nil, ErrInvalidDocID
+	}
+	if seg == nil {
+		if si.mem.isDeleted(localID) {
+			return nil, ErrInvalidDocID
+		}
+		return si.mem.doc(localID)
+	}
+	if seg.isDeleted(localID) {
+		return nil, ErrInvalidDocID
+	}
+	return seg.ds.docs.GetGob(int(localID))
+}
+
+// DocCount returns the number of docs in all segments, excluding deleted
+// ones.
+func (si *SegmentedIndex) DocCount() int {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+
+	cnt := si.mem.DocCount()
+	for _, seg := range si.segs {
+		cnt += seg.ds.DocCount() - len(seg.deleted)
+	}
+	return cnt
+}
+
+// SegmentCount returns the number of on-disk segments.
+func (si *SegmentedIndex) SegmentCount() int {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+
+	return len(si.segs)
+}
+
+// Search has the same semantics as TokenSetSearcher.Search, with global IDs.
+// All segments are searched in the order of global IDs.
+func (si *SegmentedIndex) Search(query map[string]stringsp.Set, output func(docID int64, data interface{}) error) error {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+
+	for _, seg := range si.segs {
+		if err := seg.ds.searchDocs(query, func(docID int32) error {
+			if seg.deleted[docID] {
+				return nil
+			}
+			data, err := seg.ds.docs.GetGob(int(docID))
+			if err != nil {
+				return err
+			}
+			return output(seg.globalIDs[docID], data)
+		}); err != nil {
+			return err
+		}
+	}
+	return si.mem.Search(query, func(docID int32, data interface{}) error {
+		return output(si.memBase+int64(docID), data)
+	})
+}
+
+// Flush flushes the in-memory segment to a new on-disk segment, and saves
+// deletions in on-disk segments.
+func (si *SegmentedIndex) Flush() error {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	if si.closed {
+		return ErrIndexClosed
+	}
+	return si.flushLocked()
+}
+
+func (si *SegmentedIndex) flushLocked() error {
+	if len(si.mem.docs) > 0 {
+		name := si.newSegmentName()
+		segDir := path.Join(si.dir, name)
+		if err := si.mem.SaveToDir(segDir); err != nil {
+			return err
+		}
+		globalIDs := make([]int64, len(si.mem.docs))
+		for i := range globalIDs {
+			globalIDs[i] = si.memBase + int64(i)
+		}
+		if err := writeGobFile(path.Join(segDir, siIDsFilename), globalIDs); err != nil {
+			return err
+		}
+		seg, err := si.openSegment(name)
+		if err != nil {
+			return err
+		}
+		si.segs = append(si.segs, seg)
+		si.mem = TokenSetSearcher{}
+		si.memBase = si.nextID
+	}
+	if err := si.saveLocked(); err != nil {
+		return err
+	}
+	if len(si.segs) >= si.opts.MergeFactor {
+		select {
+		case si.mergeCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (si *SegmentedIndex) newSegmentName() string {
+	name := fmt.Sprintf("%s%d", siSegmentPrefix, si.nextSegment)
+	si.nextSegment++
+	return name
+}
+
+// saveLocked saves changed deletions and the manifest.
+func (si *SegmentedIndex) saveLocked() error {
+	manifest := siManifest{
+		NextID:      si.memBase,
+		NextSegment: si.nextSegment,
+	}
+	for _, seg := range si.segs {
+		manifest.Segments = append(manifest.Segments, seg.name)
+		if !seg.dirty {
+			continue
+		}
+		deleted := make([]int32, 0, len(seg.deleted))
+		for docID := range seg.deleted {
+			deleted = append(deleted, docID)
+		}
+		if err := writeGobFile(path.Join(si.dir, seg.name, siDeletesFilename), deleted); err != nil {
+			return err
+		}
+		seg.dirty = false
+	}
+	return writeGobFile(path.Join(si.dir, siManifestFilename), &manifest)
+}
+
+func (si *SegmentedIndex) mergeLoop() {
+	defer si.wg.Done()
+	for {
+		select {
+		case <-si.mergeCh:
+			si.mergeRound()
+			if si.onMerged != nil {
+				si.onMerged()
+			}
+		case <-si.done:
+			return
+		}
+	}
+}
+
+// mergeRound merges segments until there are less than MergeFactor ones, a
+// merge fails, or the index is being closed.
+func (si *SegmentedIndex) mergeRound() {
+	for {
+		select {
+		case <-si.done:
+			return
+		default:
+		}
+		merged, err := si.mergeOnce(si.opts.MergeFactor)
+		if err != nil {
+			si.mu.Lock()
+			si.mergeErr = err
+			si.mu.Unlock()
+		}
+		if !merged || err != nil {
+			return
+		}
+	}
+}
+
+// Merge merges on-disk segments until there are at most maxSegments ones.
+func (si *SegmentedIndex) Merge(maxSegments int) error {
+	if maxSegments < 1 {
+		maxSegments = 1
+	}
+	for {
+		si.mu.RLock()
+		n := len(si.segs) - maxSegments + 1
+		si.mu.RUnlock()
+		if n <= 1 {
+			return nil
+		}
+		if merged, err := si.mergeOnce(n); !merged || err != nil {
+			return err
+		}
+	}
+}
+
+// mergeOnce merges n adjacent on-disk segments with the smallest total number
+// of docs into one, if there are at least n segments and the index is not
+// closed. Deleted docs are removed. It returns whether segments were merged.
+func (si *SegmentedIndex) mergeOnce(n int) (bool, error) {
+	si.mergeMu.Lock()
+	defer si.mergeMu.Unlock()
+
+	// Segments are only removed by merging, so the picked segments stay in
+	// si.segs until they are replaced below.
+	si.mu.Lock()
+	if si.closed || len(si.segs) < n || n < 2 {
+		si.mu.Unlock()
+		return false, nil
+	}
+	start, minDocs := 0, -1
+	for i := 0; i+n <= len(si.segs); i++ {
+		docs := 0
+		for _, seg := range si.segs[i : i+n] {
+			docs += seg.ds.docCount
+		}
+		if minDocs < 0 || docs < minDocs {
+			start, minDocs = i, docs
+		}
+	}
+	segs := append([]*segment(nil), si.segs[start:start+n]...)
+	deleted := make([]map[int32]bool, n)
+	for i, seg := range segs {
+		deleted[i] = make(map[int32]bool, len(seg.deleted))
+		for docID := range seg.deleted {
+			deleted[i][docID] = true
+		}
+	}
+	name := si.newSegmentName()
+	si.mu.Unlock()
+
+	segDir := path.Join(si.dir, name)
+	newIDs, err := mergeSegments(segDir, segs, deleted)
+	if err != nil {
+		os.RemoveAll(segDir)
+		return false, err
+	}
+	var merged *segment
+	if newIDs != nil {
+		if merged, err = si.openSegment(name); err != nil {
+			os.RemoveAll(segDir)
+			return false, err
+		}
+	} else {
+		os.RemoveAll(segDir)
+	}
+
+	si.mu.Lock()
+	if merged != nil {
+		// carry deletions during merging
+		for i, seg := range segs {
+			for docID := range seg.deleted {
+				if newID := newIDs[i][docID]; !deleted[i][docID] && newID >= 0 {
+					merged.deleted[newID] = true
+					merged.dirty = true
+				}
+			}
+		}
+	}
+	for i, seg := range si.segs {
+		if seg == segs[0] {
+			start = i
+			break
+		}
+	}
+	var replaced []*segment
+	if merged != nil {
+		replaced = append(replaced, merged)
+	}
+	si.segs = append(si.segs[:start], append(replaced, si.segs[start+n:]...)...)
+	err = si.saveLocked()
+	si.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	for _, seg := range segs {
+		seg.ds.Close()
+		os.RemoveAll(path.Join(si.dir, seg.name))
+	}
+	return true, nil
+}
+
+// mergeSegments writes segs into a new segment in dir, removing docs deleted
+// in the segments or in deleted. It returns the new local IDs of the docs of
+// each segment, -1 for removed ones, or nil if no docs remain.
+func mergeSegments(dir string, segs []*segment, deleted []map[int32]bool) ([][]int32, error) {
+	docs, err := CreateConstArray(path.Join(dir, dsDocsDir))
+	if err != nil {
+		return nil, err
+	}
+	newIDs := make([][]int32, len(segs))
+	var globalIDs []int64
+	for i, seg := range segs {
+		newIDs[i] = make([]int32, seg.ds.docCount)
+		if err := seg.ds.docs.ForEachBytes(func(docID int, bs []byte) error {
+			if seg.ds.deleted[int32(docID)] || deleted[i][int32(docID)] {
+				newIDs[i][docID] = -1
+				return nil
+			}
+			// docs are gob encoded independently, and can be copied directly
+			if _, err := docs.AppendBytes(bs); err != nil {
+				return err
+			}
+			newIDs[i][docID] = int32(len(globalIDs))
+			globalIDs = append(globalIDs, seg.globalIDs[docID])
+			return nil
+		}); err != nil {
+			docs.Close()
+			return nil, err
+		}
+	}
+	if err := docs.Close(); err != nil {
+		return nil, err
+	}
+	if len(globalIDs) == 0 {
+		return nil, nil
+	}
+
+	fields := make(map[string]stringsp.Set)
+	for _, seg := range segs {
+		for fld, tokens := range seg.ds.terms {
+			set := fields[fld]
+			for token := range tokens {
+				set.Add(token)
+			}
+			fields[fld] = set
+		}
+	}
+	pw, err := createPostingsWriter(path.Join(dir, dsPostingsDir))
+	if err != nil {
+		return nil, err
+	}
+	for fld, tokens := range fields {
+		for _, token := range tokens.Elements() {
+			l := &postingList{}
+			for i, seg := range segs {
+				sl, err := seg.ds.postingList(fld, token)
+				if err != nil {
+					pw.close()
+					return nil, err
+				}
+				for it := sl.iterator(); it.next(); {
+					if newID := newIDs[i][it.docID()]; newID >= 0 {
+						l.append(newID)
+					}
+				}
+			}
+			if l.n == 0 {
+				continue
+			}
+			if err := pw.append(fld, token, l); err != nil {
+				pw.close()
+				return nil, err
+			}
+		}
+	}
+	if err := pw.close(); err != nil {
+		return nil, err
+	}
+	if err := writeDiskSearcherMeta(dir, &diskSearcherMeta{
+		Docs:   len(globalIDs),
+		Fields: pw.terms,
+	}); err != nil {
+		return nil, err
+	}
+	if err := writeGobFile(path.Join(dir, siIDsFilename), globalIDs); err != nil {
+		return nil, err
+	}
+	return newIDs, nil
+}
+
+// writeGobFile writes v to a file with the gob encoder, using
+// writeFileAtomic.
+func writeGobFile(fn string, v interface{}) error {
+	return writeFileAtomic(fn, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(v)
+	})
+}
+
+// writeFileAtomic writes a file with write. The data are written into a
+// temporary file which is synced and then renamed, so the file is never
+// partially written.
+func writeFileAtomic(fn string, write func(w io.Writer) error) error {
+	tmp := fn + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errorsp.WithStacks(err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return errorsp.WithStacks(err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errorsp.WithStacks(err)
+	}
+	if err := f.Close(); err != nil {
+		return errorsp.WithStacks(err)
+	}
+	return errorsp.WithStacks(os.Rename(tmp, fn))
+}
+
+// readGobFile reads v from a file written by writeGobFile. If the file does
+// not exist, the error of os.Open is returned as is, for os.IsNotExist.
+func readGobFile(fn string, v interface{}) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return err
+		}
+		return errorsp.WithStacks(err)
+	}
+	defer f.Close()
+	return errorsp.WithStacks(gob.NewDecoder(f).Decode(v))
+}
@@ -0,0 +1,108 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/golangplus/testing/assert"
+)
+
+func segmentSearchDocs(t *testing.T, si *SegmentedIndex, tokens ...string) []int64 {
+	var docs []int64
+	assert.NoError(t, si.Search(SingleFieldQuery("text", tokens...), func(docID int64, data interface{}) error {
+		assert.Equal(t, "data", data, fmt.Sprint(docID))
+		docs = append(docs, docID)
+		return nil
+	}))
+	return docs
+}
+
+func TestSegmentedIndex(t *testing.T) {
+	dir := path.Join(os.TempDir(), "TestSegmentedIndex")
+	assert.NoErrorOrDie(t, os.RemoveAll(dir))
+
+	si, err := OpenSegmentedIndex(dir, &SegmentOptions{FlushDocs: 10, MergeFactor: 3})
+	assert.NoErrorOrDie(t, err)
+	merged := make(chan struct{}, 1)
+	si.onMerged = func() {
+		select {
+		case merged <- struct{}{}:
+		default:
+		}
+	}
+	for i := 0; i < 45; i++ {
+		docID, err := si.AddDoc(shardedTestDoc(i), fmt.Sprint(i))
+		assert.NoErrorOrDie(t, err)
+		assert.Equal(t, "docID", docID, int64(i))
+		if i == 15 {
+			// deleting docs in an on-disk segment and the in-memory segment
+			assert.NoError(t, si.DeleteDoc(6))
+			assert.NoError(t, si.DeleteDoc(12))
+			assert.Equal(t, "err", si.DeleteDoc(6), ErrInvalidDocID)
+		}
+	}
+	assert.Equal(t, "DocCount", si.DocCount(), 43)
+	_, err = si.DocInfo(6)
+	assert.Equal(t, "err", err, ErrInvalidDocID)
+	_, err = si.DocInfo(45)
+	assert.Equal(t, "err", err, ErrInvalidDocID)
+	data, err := si.DocInfo(44)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", data, "44")
+
+	expThree := []int64{0, 3, 9, 15, 18, 21, 24, 27, 30, 33, 36, 39, 42}
+	expEvenThree := []int64{0, 18, 24, 30, 36, 42}
+	// background merging happens at any time
+	assert.Equal(t, "three", segmentSearchDocs(t, si, "three"), expThree)
+	select {
+	case <-merged:
+	case <-time.After(time.Minute):
+		t.Fatal("background merging not done")
+	}
+	assert.ValueShould(t, "SegmentCount", si.SegmentCount(), si.SegmentCount() < 3, "should be merged")
+	assert.Equal(t, "three", segmentSearchDocs(t, si, "three"), expThree)
+	assert.Equal(t, "even three", segmentSearchDocs(t, si, "even", "three"), expEvenThree)
+
+	assert.NoError(t, si.DeleteDoc(9))
+	assert.NoError(t, si.Merge(1))
+	assert.Equal(t, "SegmentCount", si.SegmentCount(), 1)
+	expThree = append(expThree[:2], expThree[3:]...)
+	assert.Equal(t, "three", segmentSearchDocs(t, si, "three"), expThree)
+	assert.Equal(t, "all", len(segmentSearchDocs(t, si)), 42)
+	data, err = si.DocInfo(43)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", data, "43")
+	assert.NoError(t, si.Close())
+	assert.NoError(t, si.Merge(0))
+	// closed twice, and no modifications after closing
+	assert.NoError(t, si.Close())
+	_, err = si.AddDoc(shardedTestDoc(44), "44")
+	assert.Equal(t, "err", err, ErrIndexClosed)
+	assert.Equal(t, "err", si.DeleteDoc(0), ErrIndexClosed)
+	assert.Equal(t, "err", si.Flush(), ErrIndexClosed)
+
+	// a segment left by a crash in the middle of merging
+	leftover := path.Join(dir, siSegmentPrefix+"99")
+	assert.NoErrorOrDie(t, os.MkdirAll(path.Join(leftover, dsDocsDir), 0755))
+
+	// reopening
+	si, err = OpenSegmentedIndex(dir, &SegmentOptions{FlushDocs: 10, MergeFactor: 3})
+	assert.NoErrorOrDie(t, err)
+	_, err = os.Stat(leftover)
+	assert.True(t, "removed", os.IsNotExist(err))
+	assert.Equal(t, "DocCount", si.DocCount(), 42)
+	assert.Equal(t, "three", segmentSearchDocs(t, si, "three"), expThree)
+	assert.NoError(t, si.DeleteDoc(0))
+	docID, err := si.AddDoc(shardedTestDoc(45), "45")
+	assert.NoError(t, err)
+	assert.Equal(t, "docID", docID, int64(45))
+	assert.NoError(t, si.Close())
+
+	si, err = OpenSegmentedIndex(dir, nil)
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "three", segmentSearchDocs(t, si, "three"), append(expThree[1:], 45))
+	assert.NoError(t, si.Close())
+}
@@ -0,0 +1,413 @@
+package index
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/golangplus/strings"
+)
+
+const (
+	shardMagic         = "GOIDXSHD"
+	shardFormatVersion = 1
+)
+
+var (
+	// error of a shard index out of range, a non-positive number of shards,
+	// or a shard saved from a ShardedSearcher with a different number of
+	// shards
+	ErrInvalidShard = errors.New("Invalid shard")
+)
+
+// Partitioner returns the index of the shard, in [0, shards), a doc with a
+// global ID is put into.
+type Partitioner func(docID int64, shards int) int
+
+// HashPartitioner partitions docs by the hash of the global doc IDs. Zero is
+// returned if shards is not positive.
+func HashPartitioner(docID int64, shards int) int {
+	if shards <= 0 {
+		return 0
+	}
+	// the finalizer of MurmurHash3
+	h := uint64(docID)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return int(h % uint64(shards))
+}
+
+// RangePartitioner returns a Partitioner putting every size docs with
+// consecutive global IDs into a shard. Docs beyond the range of the last shard
+// are put into the last shard. It panics if size is not positive.
+func RangePartitioner(size int64) Partitioner {
+	if size <= 0 {
+		panic("index: non-positive size of RangePartitioner")
+	}
+	return func(docID int64, shards int) int {
+		if idx := docID / size; idx < int64(shards) {
+			return int(idx)
+		}
+		return shards - 1
+	}
+}
+
+// ShardedSearcher partitions docs across a number of TokenSetSearcher shards.
+// Docs are identified by global IDs of int64, so the number of docs is not
+// limited by the int32 local IDs of a shard. Searching runs on all shards
+// concurrently, and results are merged in the order of global IDs.
+//
+// A ShardedSearcher is safe for concurrent use. Like SyncTokenSetSearcher,
+// the output functions of searching methods must not call modifying methods.
+type ShardedSearcher struct {
+	mu        sync.RWMutex
+	partition Partitioner
+	shards    []searcherShard
+	// the global ID of the next doc
+	nextID int64
+}
+
+// searcherShard is a shard of a ShardedSearcher.
+type searcherShard struct {
+	s TokenSetSearcher
+	// global IDs of local docs, increasing
+	globalIDs []int64
+}
+
+// NewShardedSearcher returns a ShardedSearcher with n shards partitioned by
+// partition. HashPartitioner is used if partition is nil. ErrInvalidShard is
+// returned if n is not positive.
+func NewShardedSearcher(n int, partition Partitioner) (*ShardedSearcher, error) {
+	if n <= 0 {
+		return nil, ErrInvalidShard
+	}
+	if partition == nil {
+		partition = HashPartitioner
+	}
+	return &ShardedSearcher{
+		partition: partition,
+		shards:    make([]searcherShard, n),
+	}, nil
+}
+
+// ShardCount returns the number of shards.
+func (ss *ShardedSearcher) ShardCount() int {
+	return len(ss.shards)
+}
+
+// addDoc adds a doc with add to the shard of the next global ID, and returns
+// the global ID.
+func (ss *ShardedSearcher) addDoc(add func(s *TokenSetSearcher)) int64 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	docID := ss.nextID
+	ss.nextID++
+	sh := &ss.shards[ss.partition(docID, len(ss.shards))]
+	add(&sh.s)
+	sh.globalIDs = append(sh.globalIDs, docID)
+	return docID
+}
+
+// AddDoc adds a doc like TokenSetSearcher.AddDoc, and returns the global ID.
+func (ss *ShardedSearcher) AddDoc(fields map[string]stringsp.Set, data interface{}) int64 {
+	return ss.addDoc(func(s *TokenSetSearcher) {
+		s.AddDoc(fields, data)
+	})
+}
+
+// AddDocTokens adds a doc like TokenSetSearcher.AddDocTokens, and returns the
+// global ID.
+func (ss *ShardedSearcher) AddDocTokens(fields map[string][]string, data interface{}) int64 {
+	return ss.addDoc(func(s *TokenSetSearcher) {
+		s.AddDocTokens(fields, data)
+	})
+}
+
+// locate returns the shard and the local ID of a global ID. A nil shard is
+// returned if the doc does not exist.
+func (ss *ShardedSearcher) locate(docID int64) (*searcherShard, int32) {
+	if docID < 0 || docID >= ss.nextID {
+		return nil, -1
+	}
+	sh := &ss.shards[ss.partition(docID, len(ss.shards))]
+	i := sort.Search(len(sh.globalIDs), func(i int) bool {
+		return sh.globalIDs[i] >= docID
+	})
+	if i == len(sh.globalIDs) || sh.globalIDs[i] != docID {
+		return nil, -1
+	}
+	return sh, int32(i)
+}
+
+// DeleteDoc deletes a doc by the global ID. ErrInvalidDocID is returned if
+// the doc does not exist or was deleted.
+func (ss *ShardedSearcher) DeleteDoc(docID int64) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	sh, localID := ss.locate(docID)
+	if sh == nil {
+		return ErrInvalidDocID
+	}
+	return sh.s.DeleteDoc(localID)
+}
+
+// Compact compacts all shards removing deleted docs. Global IDs of remaining
+// docs are not changed.
+func (ss *ShardedSearcher) Compact() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for i := range ss.shards {
+		sh := &ss.shards[i]
+		if len(sh.s.deleted) == 0 {
+			continue
+		}
+		newIDs := sh.s.Compact()
+		globalIDs := sh.globalIDs[:0]
+		for localID, newID := range newIDs {
+			if newID >= 0 {
+				globalIDs = append(globalIDs, sh.globalIDs[localID])
+			}
+		}
+		sh.globalIDs = globalIDs
+	}
+}
+
+// DocInfo returns the data of a doc by the global ID. ErrInvalidDocID is
+// returned if the doc does not exist or was deleted.
+func (ss *ShardedSearcher) DocInfo(docID int64) interface{} {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	sh, localID := ss.locate(docID)
+	if sh == nil {
+		return ErrInvalidDocID
+	}
+	return sh.s.DocInfo(localID)
+}
+
+// DocCount returns the number of docs in all shards, excluding deleted ones.
+func (ss *ShardedSearcher) DocCount() int {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	cnt := 0
+	for i := range ss.shards {
+		cnt += ss.shards[i].s.DocCount()
+	}
+	return cnt
+}
+
+// Search has the same semantics as TokenSetSearcher.Search, with global IDs.
+func (ss *ShardedSearcher) Search(query map[string]stringsp.Set, output func(docID int64, data interface{}) error) error {
+	return ss.fanOut(func(s *TokenSetSearcher, output func(docID int32, data interface{}) error) error {
+		return s.Search(query, output)
+	}, output)
+}
+
+// SearchQuery has the same semantics as TokenSetSearcher.SearchQuery, with
+// global IDs.
+func (ss *ShardedSearcher) SearchQuery(q Query, output func(docID int64, data interface{}) error) error {
+	return ss.fanOut(func(s *TokenSetSearcher, output func(docID int32, data interface{}) error) error {
+		return s.SearchQuery(q, output)
+	}, output)
+}
+
+// shardHit is a hit of a shard sent to the merging goroutine.
+type shardHit struct {
+	docID int64
+	data  interface{}
+}
+
+// shardHitsBuffer is the channel buffer size of the hits of a shard.
+const shardHitsBuffer = 64
+
+// fanOut runs search on all shards concurrently, and calls output with the
+// hits merged in the order of global IDs.
+func (ss *ShardedSearcher) fanOut(search func(s *TokenSetSearcher, output func(docID int32, data interface{}) error) error, output func(docID int64, data interface{}) error) error {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	// closed when merging stops or a shard fails, so that shards stop
+	// searching and no more hits are output
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopAll := func() {
+		stopOnce.Do(func() { close(stop) })
+	}
+	hits := make([]chan shardHit, len(ss.shards))
+	errs := make([]error, len(ss.shards))
+	var wg sync.WaitGroup
+	for i := range ss.shards {
+		hits[i] = make(chan shardHit, shardHitsBuffer)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(hits[i])
+
+			sh := &ss.shards[i]
+			err := search(&sh.s, func(docID int32, data interface{}) error {
+				select {
+				case hits[i] <- shardHit{docID: sh.globalIDs[docID], data: data}:
+					return nil
+				case <-stop:
+					return errStopIteration
+				}
+			})
+			if err != nil && err != errStopIteration {
+				errs[i] = err
+				stopAll()
+			}
+		}(i)
+	}
+	err := mergeShardHits(hits, stop, output)
+	stopAll()
+	wg.Wait()
+	if err != nil && err != errStopIteration {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeShardHits merges hits of shards, each in increasing order of global
+// IDs, and calls output in increasing order of global IDs. If output returns
+// an error, the merging stops, and the error is returned. If stop is closed,
+// the merging stops with errStopIteration.
+func mergeShardHits(hits []chan shardHit, stop <-chan struct{}, output func(docID int64, data interface{}) error) error {
+	heads := make([]shardHit, len(hits))
+	// indexes of hits which are not exhausted
+	var live []int
+	for i, ch := range hits {
+		if h, ok := <-ch; ok {
+			heads[i] = h
+			live = append(live, i)
+		}
+	}
+	for len(live) > 0 {
+		mn := 0
+		for j := 1; j < len(live); j++ {
+			if heads[live[j]].docID < heads[live[mn]].docID {
+				mn = j
+			}
+		}
+		i := live[mn]
+		select {
+		case <-stop:
+			return errStopIteration
+		default:
+		}
+		if err := output(heads[i].docID, heads[i].data); err != nil {
+			return err
+		}
+		if h, ok := <-hits[i]; ok {
+			heads[i] = h
+		} else {
+			live = append(live[:mn], live[mn+1:]...)
+		}
+	}
+	return nil
+}
+
+// shardMeta is saved before the searcher of a shard.
+type shardMeta struct {
+	Shards    int
+	Shard     int
+	NextID    int64
+	GlobalIDs []int64
+}
+
+// SaveShard saves the shard of index i to w. The data include the searcher of
+// the shard in the format of TokenSetSearcher.Save and the global IDs of its
+// docs.
+func (ss *ShardedSearcher) SaveShard(i int, w io.Writer) error {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	if i < 0 || i >= len(ss.shards) {
+		return ErrInvalidShard
+	}
+	if err := writeHeader(w, shardMagic, shardFormatVersion); err != nil {
+		return err
+	}
+	sh := &ss.shards[i]
+	if err := writeSection(w, func(enc *gob.Encoder) error {
+		return enc.Encode(&shardMeta{
+			Shards:    len(ss.shards),
+			Shard:     i,
+			NextID:    ss.nextID,
+			GlobalIDs: sh.globalIDs,
+		})
+	}); err != nil {
+		return err
+	}
+	return sh.s.Save(w)
+}
+
+// LoadShard restores the shard of index i from data saved by SaveShard.
+// ErrInvalidShard is returned if the data were saved from a shard of a
+// different index, or from a ShardedSearcher with a different number of
+// shards, or if a doc does not belong to the shard under the partitioner of
+// ss, which must be the same as the one the data were saved with. The shard is
+// not changed if an error is returned.
+func (ss *ShardedSearcher) LoadShard(i int, r io.Reader) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if i < 0 || i >= len(ss.shards) {
+		return ErrInvalidShard
+	}
+	br := bufio.NewReader(r)
+	version, ok, err := readHeader(br, shardMagic)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidShard
+	}
+	if version != shardFormatVersion {
+		return ErrUnsupportedVersion
+	}
+	var meta shardMeta
+	if err := readSection(br, func(dec *gob.Decoder) error {
+		return dec.Decode(&meta)
+	}); err != nil {
+		return err
+	}
+	if meta.Shards != len(ss.shards) || meta.Shard != i {
+		return ErrInvalidShard
+	}
+	// loaded into a new searcher, so that the shard is not changed on errors
+	var s TokenSetSearcher
+	if err := s.Load(br); err != nil {
+		return err
+	}
+	if len(meta.GlobalIDs) != len(s.docs) {
+		return ErrInvalidShard
+	}
+	for j, docID := range meta.GlobalIDs {
+		if docID < 0 || docID >= meta.NextID || j > 0 && docID <= meta.GlobalIDs[j-1] {
+			return ErrInvalidShard
+		}
+		if ss.partition(docID, len(ss.shards)) != i {
+			return ErrInvalidShard
+		}
+	}
+	ss.shards[i] = searcherShard{s: s, globalIDs: meta.GlobalIDs}
+	if meta.NextID > ss.nextID {
+		ss.nextID = meta.NextID
+	}
+	return nil
+}
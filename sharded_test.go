@@ -0,0 +1,165 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func shardedTestDoc(i int) map[string]stringsp.Set {
+	tokens := stringsp.NewSet("a")
+	if i%2 == 0 {
+		tokens.Add("even")
+	}
+	if i%3 == 0 {
+		tokens.Add("three")
+	}
+	return map[string]stringsp.Set{"text": tokens}
+}
+
+func shardedSearchDocs(t *testing.T, ss *ShardedSearcher, q Query) []int64 {
+	var docs []int64
+	assert.NoError(t, ss.SearchQuery(q, func(docID int64, data interface{}) error {
+		assert.Equal(t, "data", data, fmt.Sprint(docID))
+		docs = append(docs, docID)
+		return nil
+	}))
+	return docs
+}
+
+func TestShardedSearcher(t *testing.T) {
+	for _, partition := range []Partitioner{nil, RangePartitioner(30)} {
+		ss, err := NewShardedSearcher(4, partition)
+		assert.NoErrorOrDie(t, err)
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, "docID", ss.AddDoc(shardedTestDoc(i), fmt.Sprint(i)), int64(i))
+		}
+		assert.Equal(t, "DocCount", ss.DocCount(), 100)
+
+		docs := shardedSearchDocs(t, ss, And{Term{"text", "even"}, Term{"text", "three"}})
+		assert.Equal(t, "len(docs)", len(docs), 17)
+		for i, docID := range docs {
+			assert.Equal(t, "docID", docID, int64(i*6))
+		}
+
+		var docs2 []int64
+		assert.NoError(t, ss.Search(SingleFieldQuery("text", "even"), func(docID int64, data interface{}) error {
+			docs2 = append(docs2, docID)
+			return nil
+		}))
+		assert.Equal(t, "len(docs2)", len(docs2), 50)
+		for i, docID := range docs2 {
+			assert.Equal(t, "docID", docID, int64(i*2))
+		}
+
+		assert.NoError(t, ss.DeleteDoc(6))
+		assert.Equal(t, "err", ss.DeleteDoc(6), ErrInvalidDocID)
+		assert.Equal(t, "err", ss.DeleteDoc(100), ErrInvalidDocID)
+		assert.Equal(t, "DocInfo", ss.DocInfo(6), ErrInvalidDocID)
+		assert.Equal(t, "DocInfo", ss.DocInfo(12), "12")
+		ss.Compact()
+		assert.Equal(t, "DocCount", ss.DocCount(), 99)
+		assert.Equal(t, "DocInfo", ss.DocInfo(12), "12")
+		docs = shardedSearchDocs(t, ss, And{Term{"text", "even"}, Term{"text", "three"}})
+		assert.Equal(t, "docs[:3]", docs[:3], []int64{0, 12, 18})
+
+		// stopping by an error
+		errStop := errors.New("stop")
+		cnt := 0
+		assert.Equal(t, "err", ss.SearchQuery(Term{"text", "a"}, func(docID int64, data interface{}) error {
+			if cnt++; cnt == 10 {
+				return errStop
+			}
+			return nil
+		}), errStop)
+		assert.Equal(t, "cnt", cnt, 10)
+	}
+}
+
+func TestShardedSearcher_SaveLoadShard(t *testing.T) {
+	ss, err := NewShardedSearcher(3, nil)
+	assert.NoErrorOrDie(t, err)
+	for i := 0; i < 50; i++ {
+		ss.AddDoc(shardedTestDoc(i), fmt.Sprint(i))
+	}
+	assert.NoError(t, ss.DeleteDoc(0))
+
+	bufs := make([]bytesp.Slice, ss.ShardCount())
+	for i := range bufs {
+		assert.NoErrorOrDie(t, ss.SaveShard(i, &bufs[i]))
+	}
+	assert.Equal(t, "err", ss.SaveShard(3, &bufs[0]), ErrInvalidShard)
+
+	loaded, err := NewShardedSearcher(3, nil)
+	assert.NoErrorOrDie(t, err)
+	for i := range bufs {
+		b := bufs[i]
+		assert.NoErrorOrDie(t, loaded.LoadShard(i, &b))
+	}
+	assert.Equal(t, "DocCount", loaded.DocCount(), 49)
+	assert.Equal(t, "DocInfo", loaded.DocInfo(0), ErrInvalidDocID)
+	assert.Equal(t, "DocInfo", loaded.DocInfo(49), "49")
+	docs := shardedSearchDocs(t, loaded, Term{"text", "three"})
+	assert.Equal(t, "docs[:3]", docs[:3], []int64{3, 6, 9})
+	// new docs continue the global IDs
+	assert.Equal(t, "docID", loaded.AddDoc(shardedTestDoc(50), "50"), int64(50))
+
+	// a shard of a different index or count
+	b := bufs[0]
+	assert.Equal(t, "err", loaded.LoadShard(1, &b), ErrInvalidShard)
+	b = bufs[0]
+	two, err := NewShardedSearcher(2, nil)
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "err", two.LoadShard(0, &b), ErrInvalidShard)
+	// a shard saved with a different partitioner
+	b = bufs[0]
+	ranged, err := NewShardedSearcher(3, RangePartitioner(30))
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "err", ranged.LoadShard(0, &b), ErrInvalidShard)
+
+	// a shard failing to load is not changed
+	b = append(bytesp.Slice(nil), bufs[1]...)
+	b[len(b)-1] ^= 0xff
+	assert.Equal(t, "err", loaded.LoadShard(1, &b), ErrChecksumMismatch)
+	assert.Equal(t, "DocCount", loaded.DocCount(), 50)
+	assert.Equal(t, "docs", shardedSearchDocs(t, loaded, Term{"text", "three"})[:3], []int64{3, 6, 9})
+}
+
+func TestNewShardedSearcher_Invalid(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		_, err := NewShardedSearcher(n, nil)
+		assert.Equal(t, "err", err, ErrInvalidShard)
+	}
+	assert.Equal(t, "HashPartitioner", HashPartitioner(5, 0), 0)
+	defer func() {
+		r := recover()
+		assert.ValueShould(t, "recover", r, r != nil, "should panic for a zero size")
+	}()
+	RangePartitioner(0)
+}
+
+func TestShardedSearcher_ShardFailure(t *testing.T) {
+	ss, err := NewShardedSearcher(2, RangePartitioner(1))
+	assert.NoErrorOrDie(t, err)
+	for i := 0; i < 10; i++ {
+		ss.AddDoc(shardedTestDoc(i), i)
+	}
+	errFailed := errors.New("failed")
+	var docs []int64
+	err = ss.fanOut(func(s *TokenSetSearcher, output func(docID int32, data interface{}) error) error {
+		if s == &ss.shards[0].s {
+			return errFailed
+		}
+		return s.Search(SingleFieldQuery("text", "a"), output)
+	}, func(docID int64, data interface{}) error {
+		docs = append(docs, docID)
+		return nil
+	})
+	assert.Equal(t, "err", err, errFailed)
+	// the failure of shard 0 is known before its first hit is merged
+	assert.Equal(t, "docs", len(docs), 0)
+}
@@ -0,0 +1,194 @@
+package index
+
+import (
+	"container/heap"
+	"strings"
+)
+
+// SortField is a field to sort search results by. Values of the field are
+// those of numeric fields added by AddDocNumeric, or of string fields set by
+// SetSortString.
+type SortField struct {
+	Field string
+	// If true, values are sorted in descending order.
+	Desc bool
+}
+
+// stringColumn is the string sort values of a field, indexed by local ID.
+// Missing trailing elements are docs without values.
+type stringColumn struct {
+	values []string
+	has    []bool
+}
+
+// SetSortString sets the string value of a field of a doc for sorting by
+// SearchSorted. ErrInvalidDocID is returned if the doc does not exist.
+func (s *TokenSetSearcher) SetSortString(docID int32, field, value string) error {
+	if docID < 0 || int(docID) >= len(s.docs) {
+		return ErrInvalidDocID
+	}
+	col := s.sortStrings[field]
+	if col == nil {
+		if s.sortStrings == nil {
+			s.sortStrings = make(map[string]*stringColumn)
+		}
+		col = &stringColumn{}
+		s.sortStrings[field] = col
+	}
+	for len(col.values) <= int(docID) {
+		col.values, col.has = append(col.values, ""), append(col.has, false)
+	}
+	col.values[docID], col.has[docID] = value, true
+	return nil
+}
+
+// value returns the value of a doc, and whether the doc has a value.
+func (col *stringColumn) value(docID int32) (string, bool) {
+	if col == nil || int(docID) >= len(col.has) || !col.has[docID] {
+		return "", false
+	}
+	return col.values[docID], true
+}
+
+// DocSortString returns the string sort value of a field of a doc, and
+// whether the doc has a value.
+func (s *TokenSetSearcher) DocSortString(docID int32, field string) (string, bool) {
+	return s.sortStrings[field].value(docID)
+}
+
+// compactSortStrings removes values of deleted docs, where newIDs is the
+// mapping returned by Compact.
+func (s *TokenSetSearcher) compactSortStrings(newIDs []int32) {
+	for _, col := range s.sortStrings {
+		values, has := col.values[:0], col.has[:0]
+		for docID := range col.has {
+			if newIDs[docID] >= 0 {
+				values, has = append(values, col.values[docID]), append(has, col.has[docID])
+			}
+		}
+		col.values, col.has = values, has
+	}
+}
+
+// docComparator compares docs by a list of SortFields.
+type docComparator struct {
+	fields []SortField
+	// the numeric index of each field, or nil if not a numeric field
+	nums []*numericIndex
+	// the string column of each field, or nil if not a string field
+	strs []*stringColumn
+}
+
+func (s *TokenSetSearcher) newDocComparator(sortBy []SortField) *docComparator {
+	c := &docComparator{
+		fields: sortBy,
+		nums:   make([]*numericIndex, len(sortBy)),
+		strs:   make([]*stringColumn, len(sortBy)),
+	}
+	for i, f := range sortBy {
+		if idx := s.numbers[f.Field]; idx != nil {
+			c.nums[i] = idx
+		} else {
+			c.strs[i] = s.sortStrings[f.Field]
+		}
+	}
+	return c
+}
+
+// compare returns a negative number if doc a is sorted before doc b, and a
+// positive one if after. Docs without a value of a field are sorted after
+// those with values. Ties are broken by docIDs.
+func (c *docComparator) compare(a, b int32) int {
+	for i, f := range c.fields {
+		var cmp int
+		var okA, okB bool
+		if idx := c.nums[i]; idx != nil {
+			var ka, kb uint64
+			ka, okA = idx.key(a)
+			kb, okB = idx.key(b)
+			if ka < kb {
+				cmp = -1
+			} else if ka > kb {
+				cmp = 1
+			}
+		} else {
+			var va, vb string
+			va, okA = c.strs[i].value(a)
+			vb, okB = c.strs[i].value(b)
+			cmp = strings.Compare(va, vb)
+		}
+		if okA != okB {
+			if okA {
+				return -1
+			}
+			return 1
+		}
+		if f.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return int(a) - int(b)
+}
+
+// sortedDocHeap is a heap of docIDs, the last sorted one at the top.
+type sortedDocHeap struct {
+	ids []int32
+	c   *docComparator
+}
+
+func (h *sortedDocHeap) Len() int           { return len(h.ids) }
+func (h *sortedDocHeap) Less(i, j int) bool { return h.c.compare(h.ids[i], h.ids[j]) > 0 }
+func (h *sortedDocHeap) Swap(i, j int)      { h.ids[i], h.ids[j] = h.ids[j], h.ids[i] }
+func (h *sortedDocHeap) Push(x interface{}) { h.ids = append(h.ids, x.(int32)) }
+func (h *sortedDocHeap) Pop() interface{} {
+	x := h.ids[len(h.ids)-1]
+	h.ids = h.ids[:len(h.ids)-1]
+	return x
+}
+
+// SearchSorted returns at most limit documents matching q sorted by sortBy,
+// skipping the first offset ones. Docs without a value of a field are sorted
+// after those with values, in either order. Ties are broken by docIDs. If
+// limit is not positive, all the documents after offset are returned. Total
+// of the returned page is exact.
+//
+// Sorting only reads the columns of sort values, and the data of the
+// returned documents.
+func (s *TokenSetSearcher) SearchSorted(q Query, sortBy []SortField, offset, limit int) Page {
+	if offset < 0 {
+		offset = 0
+	}
+	h := &sortedDocHeap{c: s.newDocComparator(sortBy)}
+	var page Page
+	s.iterateDocs(q, func(docID int32) error {
+		if s.isDeleted(docID) {
+			return nil
+		}
+		page.Total++
+		if limit > 0 && len(h.ids) == offset+limit {
+			if h.c.compare(docID, h.ids[0]) > 0 {
+				return nil
+			}
+			h.ids[0] = docID
+			heap.Fix(h, 0)
+		} else {
+			heap.Push(h, docID)
+		}
+		return nil
+	})
+	ids := make([]int32, len(h.ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		ids[i] = heap.Pop(h).(int32)
+	}
+	if offset >= len(ids) {
+		return page
+	}
+	page.DocIDs = ids[offset:]
+	for _, docID := range page.DocIDs {
+		page.Data = append(page.Data, s.DocInfo(docID))
+	}
+	return page
+}
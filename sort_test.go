@@ -0,0 +1,101 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTokenSetSearcher_SearchSorted(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	names := []string{"gin", "echo", "chi", "mux", "iris", "beego"}
+	stars := []int64{70, 25, 15, 25, 25}
+	for i, name := range names {
+		var nums NumericFields
+		if i < len(stars) {
+			// beego has no stars
+			nums.Ints = map[string]int64{"stars": stars[i]}
+		}
+		docID := sch.AddDocNumeric(map[string]stringsp.Set{"text": stringsp.NewSet("go")}, nums, name)
+		assert.NoError(t, sch.SetSortString(docID, "name", name))
+	}
+	assert.Equal(t, "err", sch.SetSortString(100, "name", "x"), ErrInvalidDocID)
+	v, ok := sch.DocSortString(1, "name")
+	assert.True(t, "ok", ok)
+	assert.Equal(t, "name", v, "echo")
+
+	byStarsName := []SortField{{Field: "stars", Desc: true}, {Field: "name"}}
+	check := func(sch *TokenSetSearcher) {
+		q := Term{"text", "go"}
+		page := sch.SearchSorted(q, byStarsName, 0, 0)
+		assert.StringEqual(t, "Data", page.Data, "[gin echo iris mux chi beego]")
+		assert.Equal(t, "Total", page.Total, 6)
+
+		page = sch.SearchSorted(q, byStarsName, 1, 3)
+		assert.StringEqual(t, "DocIDs", page.DocIDs, "[1 4 3]")
+		assert.StringEqual(t, "Data", page.Data, "[echo iris mux]")
+		assert.Equal(t, "Total", page.Total, 6)
+
+		// missing values go last in ascending order too
+		page = sch.SearchSorted(q, []SortField{{Field: "stars"}}, 0, 0)
+		assert.StringEqual(t, "Data", page.Data, "[chi echo mux iris gin beego]")
+
+		page = sch.SearchSorted(q, []SortField{{Field: "name", Desc: true}}, 0, 2)
+		assert.StringEqual(t, "Data", page.Data, "[mux iris]")
+
+		// ties by docIDs
+		page = sch.SearchSorted(q, []SortField{{Field: "unknown"}}, 0, 3)
+		assert.StringEqual(t, "DocIDs", page.DocIDs, "[0 1 2]")
+
+		page = sch.SearchSorted(q, byStarsName, 10, 3)
+		assert.Equal(t, "DocIDs", len(page.DocIDs), 0)
+		assert.Equal(t, "Total", page.Total, 6)
+	}
+	check(sch)
+
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	var loaded TokenSetSearcher
+	assert.NoErrorOrDie(t, loaded.Load(bytes.NewReader(b)))
+	check(&loaded)
+
+	assert.NoError(t, sch.DeleteDoc(1))
+	page := sch.SearchSorted(Term{"text", "go"}, byStarsName, 0, 0)
+	assert.StringEqual(t, "Data", page.Data, "[gin iris mux chi beego]")
+	assert.Equal(t, "Total", page.Total, 5)
+	sch.Compact()
+	page = sch.SearchSorted(Term{"text", "go"}, byStarsName, 0, 0)
+	assert.StringEqual(t, "DocIDs", page.DocIDs, "[0 3 2 1 4]")
+	assert.StringEqual(t, "Data", page.Data, "[gin iris mux chi beego]")
+}
+
+func TestTokenSetSearcher_SearchSorted_TopK(t *testing.T) {
+	// the top-K heap gives the same result as sorting all the docs
+	sch := &TokenSetSearcher{}
+	const n = 500
+	for i := 0; i < n; i++ {
+		docID := sch.AddDocNumeric(map[string]stringsp.Set{"text": stringsp.NewSet("go")}, NumericFields{
+			Floats: map[string]float64{"score": float64((i * 7919) % 37)},
+		}, i)
+		assert.NoError(t, sch.SetSortString(docID, "name", fmt.Sprintf("%03d", (i*31)%101)))
+	}
+	sortBy := []SortField{{Field: "score", Desc: true}, {Field: "name"}}
+	all := sch.SearchSorted(Term{"text", "go"}, sortBy, 0, 0)
+	assert.Equal(t, "len", len(all.DocIDs), n)
+	assert.True(t, "sorted", sort.SliceIsSorted(all.DocIDs, func(i, j int) bool {
+		return sch.newDocComparator(sortBy).compare(all.DocIDs[i], all.DocIDs[j]) < 0
+	}))
+	for _, offset := range []int{0, 10, 490} {
+		page := sch.SearchSorted(Term{"text", "go"}, sortBy, offset, 20)
+		end := offset + 20
+		if end > n {
+			end = n
+		}
+		assert.Equal(t, "DocIDs", page.DocIDs, all.DocIDs[offset:end])
+	}
+}
@@ -0,0 +1,201 @@
+package index
+
+import (
+	"container/heap"
+	"math/bits"
+	"sort"
+	"unsafe"
+)
+
+// TermInfo is a token of a field with its document frequency.
+type TermInfo struct {
+	Field   string
+	Token   string
+	DocFreq int
+}
+
+// FieldStats are the statistics of the tokens of a field.
+type FieldStats struct {
+	// Number of distinct tokens.
+	Terms int
+	// The tokens with the largest document frequencies, sorted in descending
+	// order of DocFreq, and by tokens for a tie.
+	TopTokens []TermInfo
+	// Histogram of the sizes of posting lists. PostingSizes[i] is the number
+	// of tokens whose posting lists have [2^i, 2^(i+1)) docs.
+	PostingSizes []int
+}
+
+// Stats are the statistics of a TokenSetSearcher.
+type Stats struct {
+	// Number of docs, excluding deleted ones.
+	DocCount int
+	// Number of deleted docs not compacted yet.
+	DeletedCount int
+	// Number of distinct tokens of all fields.
+	Terms  int
+	Fields map[string]*FieldStats
+	// Histogram of the sizes of all posting lists, like FieldStats.
+	PostingSizes []int
+	// A rough estimate of the memory used by the index, excluding the data
+	// of docs not loaded lazily.
+	MemoryBytes int64
+}
+
+// IterateTerms calls output with each field, token and its document frequency
+// in the lexical order of fields, then tokens. Document frequencies include
+// deleted docs until Compact. If output returns an error, the iteration stops,
+// and the error is returned.
+func (s *TokenSetSearcher) IterateTerms(output func(field, token string, df int) error) error {
+	names := make([]string, 0, len(s.fields))
+	for _, fi := range s.fields {
+		names = append(names, fi.name)
+	}
+	sort.Strings(names)
+	var err error
+	for _, name := range names {
+		fi := s.field(name)
+		fi.ascend("", func(token string) bool {
+			err = output(name, token, fi.inverted[token].len())
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addPostingSize adds a posting list of n docs to histogram hist. Empty lists
+// are not counted.
+func addPostingSize(hist []int, n int) []int {
+	if n <= 0 {
+		return hist
+	}
+	b := bits.Len(uint(n)) - 1
+	for len(hist) <= b {
+		hist = append(hist, 0)
+	}
+	hist[b]++
+	return hist
+}
+
+// termInfoHeap is a min-heap of TermInfos, the one ranked last at the top.
+type termInfoHeap []TermInfo
+
+func worseTermInfo(a, b TermInfo) bool {
+	if a.DocFreq != b.DocFreq {
+		return a.DocFreq < b.DocFreq
+	}
+	return a.Token > b.Token
+}
+
+func (h termInfoHeap) Len() int            { return len(h) }
+func (h termInfoHeap) Less(i, j int) bool  { return worseTermInfo(h[i], h[j]) }
+func (h termInfoHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *termInfoHeap) Push(x interface{}) { *h = append(*h, x.(TermInfo)) }
+func (h *termInfoHeap) Pop() interface{} {
+	x := (*h)[len(*h)-1]
+	*h = (*h)[:len(*h)-1]
+	return x
+}
+
+// Stats returns the statistics of the searcher with at most topN top tokens
+// of each field. Document frequencies include deleted docs until Compact.
+func (s *TokenSetSearcher) Stats(topN int) Stats {
+	st := Stats{
+		DocCount:     s.DocCount(),
+		DeletedCount: len(s.deleted),
+		Fields:       make(map[string]*FieldStats),
+		MemoryBytes:  s.memoryBytes(),
+	}
+	// the top tokens of each field, at most topN
+	tops := make(map[string]*termInfoHeap)
+	s.IterateTerms(func(field, token string, df int) error {
+		fs := st.Fields[field]
+		if fs == nil {
+			fs = &FieldStats{}
+			st.Fields[field] = fs
+		}
+		st.Terms++
+		fs.Terms++
+		fs.PostingSizes = addPostingSize(fs.PostingSizes, df)
+		st.PostingSizes = addPostingSize(st.PostingSizes, df)
+		if topN <= 0 {
+			return nil
+		}
+		h := tops[field]
+		if h == nil {
+			h = &termInfoHeap{}
+			tops[field] = h
+		}
+		ti := TermInfo{Field: field, Token: token, DocFreq: df}
+		if len(*h) == topN {
+			if worseTermInfo(ti, (*h)[0]) {
+				return nil
+			}
+			(*h)[0] = ti
+			heap.Fix(h, 0)
+		} else {
+			heap.Push(h, ti)
+		}
+		return nil
+	})
+	for field, h := range tops {
+		top := make([]TermInfo, h.Len())
+		for i := len(top) - 1; i >= 0; i-- {
+			top[i] = heap.Pop(h).(TermInfo)
+		}
+		st.Fields[field].TopTokens = top
+	}
+	return st
+}
+
+// Sizes in bytes of headers used by memoryBytes.
+const (
+	sliceHeaderSize     = int64(unsafe.Sizeof([]byte(nil)))
+	stringHeaderSize    = int64(unsafe.Sizeof(""))
+	interfaceHeaderSize = int64(unsafe.Sizeof(interface{}(nil)))
+	// a rough overhead of a map entry besides the key and the value
+	mapEntryOverhead = 16
+)
+
+// memoryBytes returns a rough estimate of the memory used by the index.
+func (s *TokenSetSearcher) memoryBytes() int64 {
+	var m int64
+	m += int64(len(s.docs)) * interfaceHeaderSize
+	for _, data := range s.docs {
+		if bs, ok := data.(lazyDoc); ok {
+			m += sliceHeaderSize + int64(len(bs))
+		}
+	}
+	for _, fi := range s.fields {
+		m += 8 + mapEntryOverhead + stringHeaderSize + int64(len(fi.name)) + int64(unsafe.Sizeof(*fi))
+		for token, l := range fi.inverted {
+			m += mapEntryOverhead + stringHeaderSize + int64(len(token)) + 8
+			m += int64(unsafe.Sizeof(*l)) + int64(len(l.data)) + int64(len(l.skips))*int64(unsafe.Sizeof(postingSkip{}))
+		}
+		// the term dictionary shares strings with inverted
+		m += int64(len(fi.terms.sorted)+len(fi.terms.pending)) * stringHeaderSize
+		for token, poss := range fi.positions {
+			m += mapEntryOverhead + stringHeaderSize + int64(len(token)) + sliceHeaderSize
+			for _, ps := range poss {
+				m += sliceHeaderSize + int64(len(ps))*4
+			}
+		}
+		m += int64(len(fi.lens)) * 4
+	}
+	m += int64(len(s.deleted)) * (mapEntryOverhead + 4 + 1)
+	for fld, idx := range s.numbers {
+		m += mapEntryOverhead + stringHeaderSize + int64(len(fld)) + int64(unsafe.Sizeof(*idx))
+		m += int64(len(idx.keys))*(8+1) + int64(len(idx.sorted)+len(idx.pending))*int64(unsafe.Sizeof(numEntry{}))
+	}
+	for fld, col := range s.sortStrings {
+		m += mapEntryOverhead + stringHeaderSize + int64(len(fld)) + int64(unsafe.Sizeof(*col))
+		m += int64(len(col.has)) * (stringHeaderSize + 1)
+		for _, v := range col.values {
+			m += int64(len(v))
+		}
+	}
+	return m
+}
@@ -0,0 +1,91 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTokenSetSearcher_Stats(t *testing.T) {
+	sch := &TokenSetSearcher{}
+	for i := 0; i < 10; i++ {
+		tokens := stringsp.NewSet("go", fmt.Sprintf("t%d", i))
+		if i%2 == 0 {
+			tokens.Add("even")
+		}
+		if i%5 == 0 {
+			tokens.Add("five")
+		}
+		sch.AddDoc(map[string]stringsp.Set{
+			"text": tokens,
+			"name": stringsp.NewSet(fmt.Sprintf("n%d", i%3)),
+		}, i)
+	}
+	assert.NoError(t, sch.DeleteDoc(9))
+
+	st := sch.Stats(3)
+	assert.Equal(t, "DocCount", st.DocCount, 9)
+	assert.Equal(t, "DeletedCount", st.DeletedCount, 1)
+	assert.Equal(t, "Terms", st.Terms, 16)
+	assert.Equal(t, "len(Fields)", len(st.Fields), 2)
+
+	text := st.Fields["text"]
+	assert.Equal(t, "Terms", text.Terms, 13)
+	assert.Equal(t, "TopTokens", text.TopTokens, []TermInfo{
+		{Field: "text", Token: "go", DocFreq: 10},
+		{Field: "text", Token: "even", DocFreq: 5},
+		{Field: "text", Token: "five", DocFreq: 2},
+	})
+	// 10 t*, five, even, go
+	assert.Equal(t, "PostingSizes", text.PostingSizes, []int{10, 1, 1, 1})
+
+	name := st.Fields["name"]
+	assert.Equal(t, "Terms", name.Terms, 3)
+	assert.Equal(t, "TopTokens", name.TopTokens, []TermInfo{
+		{Field: "name", Token: "n0", DocFreq: 4},
+		{Field: "name", Token: "n1", DocFreq: 3},
+		{Field: "name", Token: "n2", DocFreq: 3},
+	})
+	assert.Equal(t, "PostingSizes", name.PostingSizes, []int{0, 2, 1})
+	// ties are cut by tokens
+	assert.Equal(t, "TopTokens", sch.Stats(2).Fields["name"].TopTokens, []TermInfo{
+		{Field: "name", Token: "n0", DocFreq: 4},
+		{Field: "name", Token: "n1", DocFreq: 3},
+	})
+	assert.Equal(t, "PostingSizes", st.PostingSizes, []int{10, 3, 2, 1})
+	assert.Equal(t, "PostingSizes", addPostingSize(nil, 0), []int(nil))
+
+	assert.ValueShould(t, "MemoryBytes", st.MemoryBytes, st.MemoryBytes > 0, "should be positive")
+	sch.AddDoc(map[string]stringsp.Set{"text": stringsp.NewSet("new")}, nil)
+	m := sch.Stats(0).MemoryBytes
+	assert.ValueShould(t, "MemoryBytes", m, m > st.MemoryBytes, "should increase")
+	assert.Equal(t, "TopTokens", len(sch.Stats(0).Fields["text"].TopTokens), 0)
+}
+
+func TestTokenSetSearcher_IterateTerms(t *testing.T) {
+	sch := indexDocs([][2]string{
+		{"0", "net http"},
+		{"1", "gorilla http"},
+	})
+	var terms []TermInfo
+	assert.NoError(t, sch.IterateTerms(func(field, token string, df int) error {
+		terms = append(terms, TermInfo{Field: field, Token: token, DocFreq: df})
+		return nil
+	}))
+	assert.Equal(t, "terms", terms, []TermInfo{
+		{Field: "text", Token: "gorilla", DocFreq: 1},
+		{Field: "text", Token: "http", DocFreq: 2},
+		{Field: "text", Token: "net", DocFreq: 1},
+	})
+
+	errStop := errors.New("stop")
+	cnt := 0
+	assert.Equal(t, "err", sch.IterateTerms(func(field, token string, df int) error {
+		cnt++
+		return errStop
+	}), errStop)
+	assert.Equal(t, "cnt", cnt, 1)
+}
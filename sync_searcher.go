@@ -0,0 +1,256 @@
+package index
+
+import (
+	"io"
+	"sync"
+
+	"github.com/golangplus/strings"
+)
+
+// SyncTokenSetSearcher is a TokenSetSearcher safe for concurrent use.
+// Searching methods can run concurrently with each other, while modifying
+// methods run exclusively, so each search sees a consistent view of the
+// searcher during its whole run.
+//
+// The output functions of searching methods must not call modifying methods,
+// otherwise they deadlock.
+//
+// The zero value is an empty searcher ready to use.
+type SyncTokenSetSearcher struct {
+	mu sync.RWMutex
+	s  TokenSetSearcher
+}
+
+// View calls f with the underlying searcher under the read lock. f must not
+// modify the searcher.
+func (ss *SyncTokenSetSearcher) View(f func(s *TokenSetSearcher) error) error {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return f(&ss.s)
+}
+
+// Update calls f with the underlying searcher under the write lock.
+func (ss *SyncTokenSetSearcher) Update(f func(s *TokenSetSearcher) error) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return f(&ss.s)
+}
+
+// AddDoc is the thread-safe version of TokenSetSearcher.AddDoc.
+func (ss *SyncTokenSetSearcher) AddDoc(fields map[string]stringsp.Set, data interface{}) int32 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.s.AddDoc(fields, data)
+}
+
+// AddDocTokens is the thread-safe version of TokenSetSearcher.AddDocTokens.
+func (ss *SyncTokenSetSearcher) AddDocTokens(fields map[string][]string, data interface{}) int32 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.s.AddDocTokens(fields, data)
+}
+
+// AddDocNumeric is the thread-safe version of TokenSetSearcher.AddDocNumeric.
+func (ss *SyncTokenSetSearcher) AddDocNumeric(fields map[string]stringsp.Set, nums NumericFields, data interface{}) int32 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.s.AddDocNumeric(fields, nums, data)
+}
+
+// SetSortString is the thread-safe version of TokenSetSearcher.SetSortString.
+func (ss *SyncTokenSetSearcher) SetSortString(docID int32, field, value string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.s.SetSortString(docID, field, value)
+}
+
+// DeleteDoc is the thread-safe version of TokenSetSearcher.DeleteDoc.
+func (ss *SyncTokenSetSearcher) DeleteDoc(docID int32) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.s.DeleteDoc(docID)
+}
+
+// UpdateDoc is the thread-safe version of TokenSetSearcher.UpdateDoc.
+func (ss *SyncTokenSetSearcher) UpdateDoc(docID int32, fields map[string]stringsp.Set, data interface{}) (int32, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.s.UpdateDoc(docID, fields, data)
+}
+
+// Compact is the thread-safe version of TokenSetSearcher.Compact.
+func (ss *SyncTokenSetSearcher) Compact() []int32 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.s.Compact()
+}
+
+// Search is the thread-safe version of TokenSetSearcher.Search.
+func (ss *SyncTokenSetSearcher) Search(query map[string]stringsp.Set, output func(docID int32, data interface{}) error) error {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.Search(query, output)
+}
+
+// SearchQuery is the thread-safe version of TokenSetSearcher.SearchQuery.
+func (ss *SyncTokenSetSearcher) SearchQuery(q Query, output func(docID int32, data interface{}) error) error {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.SearchQuery(q, output)
+}
+
+// EnableCache is the thread-safe version of TokenSetSearcher.EnableCache.
+func (ss *SyncTokenSetSearcher) EnableCache(capacity int) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.s.EnableCache(capacity)
+}
+
+// CacheStats is the thread-safe version of TokenSetSearcher.CacheStats.
+func (ss *SyncTokenSetSearcher) CacheStats() CacheStats {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.CacheStats()
+}
+
+// Stats is the thread-safe version of TokenSetSearcher.Stats.
+func (ss *SyncTokenSetSearcher) Stats(topN int) Stats {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.Stats(topN)
+}
+
+// IterateTerms is the thread-safe version of TokenSetSearcher.IterateTerms.
+func (ss *SyncTokenSetSearcher) IterateTerms(output func(field, token string, df int) error) error {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.IterateTerms(output)
+}
+
+// Explain is the thread-safe version of TokenSetSearcher.Explain.
+func (ss *SyncTokenSetSearcher) Explain(q Query, docID int32) (*DocExplanation, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.Explain(q, docID)
+}
+
+// SearchSorted is the thread-safe version of TokenSetSearcher.SearchSorted.
+func (ss *SyncTokenSetSearcher) SearchSorted(q Query, sortBy []SortField, offset, limit int) Page {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.SearchSorted(q, sortBy, offset, limit)
+}
+
+// SearchRanked is the thread-safe version of TokenSetSearcher.SearchRanked.
+func (ss *SyncTokenSetSearcher) SearchRanked(q Query, topK int, opts *RankOptions) []ScoredDoc {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.SearchRanked(q, topK, opts)
+}
+
+// ExpandPrefix is the thread-safe version of TokenSetSearcher.ExpandPrefix.
+func (ss *SyncTokenSetSearcher) ExpandPrefix(field, prefix string, max int) []string {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.ExpandPrefix(field, prefix, max)
+}
+
+// ExpandWildcard is the thread-safe version of TokenSetSearcher.ExpandWildcard.
+func (ss *SyncTokenSetSearcher) ExpandWildcard(field, pattern string, max int) []string {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.ExpandWildcard(field, pattern, max)
+}
+
+// FuzzyTokens is the thread-safe version of TokenSetSearcher.FuzzyTokens.
+func (ss *SyncTokenSetSearcher) FuzzyTokens(field, token string, maxDist, max int) []FuzzyToken {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.FuzzyTokens(field, token, maxDist, max)
+}
+
+// Suggest is the thread-safe version of TokenSetSearcher.Suggest.
+func (ss *SyncTokenSetSearcher) Suggest(field, token string, maxDist int) (suggestion string, ok bool) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.Suggest(field, token, maxDist)
+}
+
+// Facets is the thread-safe version of TokenSetSearcher.Facets.
+func (ss *SyncTokenSetSearcher) Facets(q Query, fields []string, topN int) map[string][]FacetCount {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.Facets(q, fields, topN)
+}
+
+// SearchPage is the thread-safe version of TokenSetSearcher.SearchPage.
+func (ss *SyncTokenSetSearcher) SearchPage(q Query, offset, limit int, estimateTotal bool) Page {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.SearchPage(q, offset, limit, estimateTotal)
+}
+
+// DocInfo is the thread-safe version of TokenSetSearcher.DocInfo.
+func (ss *SyncTokenSetSearcher) DocInfo(docID int32) interface{} {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.DocInfo(docID)
+}
+
+// DocCount is the thread-safe version of TokenSetSearcher.DocCount.
+func (ss *SyncTokenSetSearcher) DocCount() int {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.DocCount()
+}
+
+// Save is the thread-safe version of TokenSetSearcher.Save.
+func (ss *SyncTokenSetSearcher) Save(w io.Writer) error {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return ss.s.Save(w)
+}
+
+// Load is the thread-safe version of TokenSetSearcher.Load.
+func (ss *SyncTokenSetSearcher) Load(r io.Reader) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.s.Load(r)
+}
+
+// LoadWithOptions is the thread-safe version of
+// TokenSetSearcher.LoadWithOptions.
+func (ss *SyncTokenSetSearcher) LoadWithOptions(r io.Reader, opts LoadOptions) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.s.LoadWithOptions(r, opts)
+}
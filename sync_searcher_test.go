@@ -0,0 +1,61 @@
+package index
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/golangplus/strings"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestSyncTokenSetSearcher_SearchDuringAddDoc(t *testing.T) {
+	const docs = 1000
+	var ss SyncTokenSetSearcher
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < docs; i++ {
+			tokens := stringsp.NewSet("a")
+			if i%2 == 0 {
+				tokens.Add("b")
+			}
+			ss.AddDoc(map[string]stringsp.Set{"text": tokens}, i)
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				var cntA, cntAB int
+				ss.View(func(s *TokenSetSearcher) error {
+					s.Search(SingleFieldQuery("text", "a"), func(int32, interface{}) error {
+						cntA++
+						return nil
+					})
+					s.Search(SingleFieldQuery("text", "a", "b"), func(int32, interface{}) error {
+						cntAB++
+						return nil
+					})
+					// a consistent view
+					assert.Equal(t, "cntA", cntA, s.DocCount())
+					return nil
+				})
+				assert.Equal(t, "cntAB", cntAB, (cntA+1)/2)
+				ss.SearchQuery(Or{Term{"text", "b"}}, func(docID int32, data interface{}) error {
+					assert.Equal(t, "data", data, int(docID))
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, "DocCount", ss.DocCount(), docs)
+	assert.NoError(t, ss.DeleteDoc(0))
+	assert.Equal(t, "DocCount", ss.DocCount(), docs-1)
+	assert.Equal(t, "Compact", len(ss.Compact()), docs)
+	assert.Equal(t, "DocInfo(0)", ss.DocInfo(0), 1)
+}
@@ -0,0 +1,188 @@
+package index
+
+import (
+	"sort"
+	"strings"
+)
+
+// termDict is a sorted dictionary of the keys in the inverted map.
+type termDict struct {
+	sorted []string
+	// recently added keys, sorted. They are merged into sorted when there are
+	// too many of them.
+	pending []string
+}
+
+// newTermDict returns a termDict containing keys.
+func newTermDict(keys []string) termDict {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	return termDict{sorted: sorted}
+}
+
+// add inserts a key not in the dictionary.
+func (d *termDict) add(key string) {
+	d.pending = addToSortedString(d.pending, key)
+	if n := len(d.pending); n > 256 && n*n > len(d.sorted) {
+		d.sorted = mergeSortedStrings(d.sorted, d.pending)
+		d.pending = nil
+	}
+}
+
+// ascend calls f with keys not less than from in increasing order, until f
+// returns false.
+func (d *termDict) ascend(from string, f func(key string) bool) {
+	i, j := sort.SearchStrings(d.sorted, from), sort.SearchStrings(d.pending, from)
+	for i < len(d.sorted) || j < len(d.pending) {
+		var key string
+		if j == len(d.pending) || i < len(d.sorted) && d.sorted[i] < d.pending[j] {
+			key, i = d.sorted[i], i+1
+		} else {
+			key, j = d.pending[j], j+1
+		}
+		if !f(key) {
+			return
+		}
+	}
+}
+
+// mergeSortedStrings merges two sorted lists into a new sorted list.
+func mergeSortedStrings(a, b []string) []string {
+	res := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] <= b[j] {
+			res, i = append(res, a[i]), i+1
+		} else {
+			res, j = append(res, b[j]), j+1
+		}
+	}
+	res = append(res, a[i:]...)
+	return append(res, b[j:]...)
+}
+
+// DefaultMaxExpansions is the maximum number of tokens a Prefix or Wildcard
+// query expands to, if its MaxExpansions is not positive.
+const DefaultMaxExpansions = 1024
+
+// Prefix matches documents containing any token in Field starting with
+// Prefix. At most MaxExpansions tokens (the smallest ones in lexical order)
+// are expanded. DefaultMaxExpansions is used if MaxExpansions is not
+// positive.
+type Prefix struct {
+	Field         string
+	Prefix        string
+	MaxExpansions int
+}
+
+// Wildcard matches documents containing any token in Field matching Pattern,
+// where '*' matches any sequence of runes, and '?' matches a single rune.
+// MaxExpansions has the same meaning as in Prefix.
+type Wildcard struct {
+	Field         string
+	Pattern       string
+	MaxExpansions int
+}
+
+func maxExpansions(max int) int {
+	if max <= 0 {
+		return DefaultMaxExpansions
+	}
+	return max
+}
+
+func (q Prefix) docList(s *TokenSetSearcher) []int32 {
+	return s.unionTokens(q.Field, s.ExpandPrefix(q.Field, q.Prefix, maxExpansions(q.MaxExpansions)))
+}
+
+func (q Wildcard) docList(s *TokenSetSearcher) []int32 {
+	return s.unionTokens(q.Field, s.ExpandWildcard(q.Field, q.Pattern, maxExpansions(q.MaxExpansions)))
+}
+
+// unionTokens returns the union of the inverted lists of tokens in field.
+func (s *TokenSetSearcher) unionTokens(field string, tokens []string) []int32 {
+	fi := s.field(field)
+	lists := make([][]int32, len(tokens))
+	for i, token := range tokens {
+		lists[i] = fi.postings(token).docIDs()
+	}
+	// merge in pairs
+	for len(lists) > 1 {
+		for i := 0; i+1 < len(lists); i += 2 {
+			lists[i/2] = unionInvLists(lists[i], lists[i+1])
+		}
+		if len(lists)%2 == 1 {
+			lists[len(lists)/2] = lists[len(lists)-1]
+		}
+		lists = lists[:(len(lists)+1)/2]
+	}
+	if len(lists) == 0 {
+		return nil
+	}
+	return lists[0]
+}
+
+// ExpandPrefix returns at most max (unlimited if max <= 0) tokens in field
+// starting with prefix, in lexical order.
+func (s *TokenSetSearcher) ExpandPrefix(field, prefix string, max int) []string {
+	return s.expandTokens(field, prefix, max, nil)
+}
+
+// ExpandWildcard returns at most max (unlimited if max <= 0) tokens in field
+// matching pattern, in lexical order. See Wildcard for the syntax of pattern.
+func (s *TokenSetSearcher) ExpandWildcard(field, pattern string, max int) []string {
+	p := strings.IndexAny(pattern, "*?")
+	if p < 0 {
+		if s.docFreq(field, pattern) == 0 {
+			return nil
+		}
+		return []string{pattern}
+	}
+	return s.expandTokens(field, pattern[:p], max, func(token string) bool {
+		return matchWildcard(pattern, token)
+	})
+}
+
+// expandTokens returns at most max tokens in field starting with prefix and
+// accepted by match, if it is not nil.
+func (s *TokenSetSearcher) expandTokens(field, prefix string, max int, match func(token string) bool) []string {
+	var tokens []string
+	s.field(field).ascend(prefix, func(token string) bool {
+		if !strings.HasPrefix(token, prefix) {
+			return false
+		}
+		if match != nil && !match(token) {
+			return true
+		}
+		tokens = append(tokens, token)
+		return max <= 0 || len(tokens) < max
+	})
+	return tokens
+}
+
+// matchWildcard returns whether s matches pattern with '*' and '?'.
+func matchWildcard(pattern, s string) bool {
+	p, r := []rune(pattern), []rune(s)
+	// the position after the last '*', and the corresponding position in r
+	star, starR := -1, 0
+	i, j := 0, 0
+	for j < len(r) {
+		switch {
+		case i < len(p) && p[i] == '*':
+			i++
+			star, starR = i, j
+		case i < len(p) && (p[i] == '?' || p[i] == r[j]):
+			i, j = i+1, j+1
+		case star >= 0:
+			// let the last '*' match one more rune
+			starR++
+			i, j = star, starR
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
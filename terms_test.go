@@ -0,0 +1,93 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTermDict(t *testing.T) {
+	var d termDict
+	var exp []string
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("k%d", (i*7919)%1000)
+		d.add(key)
+		exp = append(exp, key)
+	}
+	sort.Strings(exp)
+	assert.True(t, "merged", len(d.sorted) > 0)
+
+	var keys []string
+	d.ascend("", func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.Equal(t, "keys", keys, exp)
+
+	keys = nil
+	d.ascend("k99", func(key string) bool {
+		keys = append(keys, key)
+		return len(keys) < 3
+	})
+	assert.Equal(t, "keys", keys, []string{"k99", "k990", "k991"})
+}
+
+func TestMatchWildcard(t *testing.T) {
+	for _, c := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"http*", "http", true},
+		{"http*", "httpx", true},
+		{"json?", "json", false},
+		{"json?", "jsonx", true},
+		{"*err*", "errors", true},
+		{"*err*", "goerr", true},
+		{"a*b*c", "abbbc", true},
+		{"a*b*c", "acb", false},
+		{"日?", "日本", true},
+		{"*", "", true},
+		{"a*", "a*b", true},
+		{"a*c", "a*bc", true},
+	} {
+		assert.Equal(t, c.pattern+" "+c.s, matchWildcard(c.pattern, c.s), c.match)
+	}
+}
+
+func TestTokenSetSearcher_PrefixWildcard(t *testing.T) {
+	sch := indexDocs([][2]string{
+		{"0", "http httprouter"},
+		{"1", "json jsonx"},
+		{"2", "httputil jsons"},
+		{"3", "ht"},
+	})
+
+	assert.Equal(t, "ExpandPrefix", sch.ExpandPrefix("text", "http", 0),
+		[]string{"http", "httprouter", "httputil"})
+	assert.Equal(t, "ExpandPrefix", sch.ExpandPrefix("text", "http", 2),
+		[]string{"http", "httprouter"})
+	assert.Equal(t, "ExpandWildcard", sch.ExpandWildcard("text", "json?", 0),
+		[]string{"jsons", "jsonx"})
+	assert.Equal(t, "ExpandWildcard", sch.ExpandWildcard("text", "*ttp*", 0),
+		[]string{"http", "httprouter", "httputil"})
+	assert.Equal(t, "ExpandWildcard", sch.ExpandWildcard("text", "ht", 0), []string{"ht"})
+
+	assert.StringEqual(t, "http*", searchQueryDocs(t, sch, Prefix{Field: "text", Prefix: "http"}), "[0 2]")
+	assert.StringEqual(t, "http* max 1", searchQueryDocs(t, sch,
+		Prefix{Field: "text", Prefix: "http", MaxExpansions: 1}), "[0]")
+	assert.StringEqual(t, "json?", searchQueryDocs(t, sch, Wildcard{Field: "text", Pattern: "json?"}), "[1 2]")
+	assert.StringEqual(t, "h*", searchQueryDocs(t, sch, Wildcard{Field: "text", Pattern: "h*"}), "[0 2 3]")
+	assert.StringEqual(t, "x*", searchQueryDocs(t, sch, Prefix{Field: "text", Prefix: "x"}), "[]")
+
+	// the dictionary is rebuilt after Compact and Load
+	assert.NoError(t, sch.DeleteDoc(0))
+	sch.Compact()
+	assert.Equal(t, "ExpandPrefix", sch.ExpandPrefix("text", "http", 0), []string{"httputil"})
+	var b bytesp.Slice
+	assert.NoErrorOrDie(t, sch.Save(&b))
+	assert.NoErrorOrDie(t, sch.Load(&b))
+	assert.Equal(t, "ExpandPrefix", sch.ExpandPrefix("text", "json", 0), []string{"json", "jsons", "jsonx"})
+}
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"bufio"
 	"encoding/gob"
 	"io"
 	"sort"
@@ -85,29 +86,48 @@ func (ti *TokenIndexer) TokensOfId(id string) []string {
 	return ti.idTokens[id]
 }
 
-// Saves serializes the TokenIndexer data to a Writer with the gob encoder.
+// Saves serializes the TokenIndexer data to a Writer. The data start with a
+// header of magic bytes and the format version, followed by a gob stream with
+// a CRC32 checksum.
 func (ti *TokenIndexer) Save(w io.Writer) error {
-	enc := gob.NewEncoder(w)
-	if err := enc.Encode(ti.idTokens); err != nil {
+	if err := writeHeader(w, indexerMagic, indexerFormatVersion); err != nil {
 		return err
 	}
-	if err := enc.Encode(ti.tokenIds); err != nil {
-		return err
-	}
-	return nil
+	return writeSection(w, func(enc *gob.Encoder) error {
+		if err := enc.Encode(ti.idTokens); err != nil {
+			return err
+		}
+		return enc.Encode(ti.tokenIds)
+	})
 }
 
-// Load restores the TokenIndexer data from a Reader with the gob decoder.
+// Load restores the TokenIndexer data from a Reader. ErrChecksumMismatch is
+// returned if the data are corrupted, and ErrUnsupportedVersion if they were
+// saved by a newer version. Headerless data saved by older versions can also
+// be loaded.
 func (ti *TokenIndexer) Load(r io.Reader) error {
 	*ti = TokenIndexer{}
 
-	dec := gob.NewDecoder(r)
-	if err := dec.Decode(&(ti.idTokens)); err != nil {
+	br := bufio.NewReader(r)
+	version, ok, err := readHeader(br, indexerMagic)
+	if err != nil {
 		return err
 	}
-	if err := dec.Decode(&(ti.tokenIds)); err != nil {
-		return err
+	if !ok {
+		// headerless data
+		dec := gob.NewDecoder(br)
+		if err := dec.Decode(&(ti.idTokens)); err != nil {
+			return err
+		}
+		return dec.Decode(&(ti.tokenIds))
 	}
-
-	return nil
+	if version != indexerFormatVersion {
+		return ErrUnsupportedVersion
+	}
+	return readSection(br, func(dec *gob.Decoder) error {
+		if err := dec.Decode(&(ti.idTokens)); err != nil {
+			return err
+		}
+		return unexpectedEOF(dec.Decode(&(ti.tokenIds)))
+	})
 }
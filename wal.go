@@ -0,0 +1,521 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/golangplus/errors"
+	"github.com/golangplus/strings"
+)
+
+var (
+	// error of a log record inconsistent with the searcher it is replayed on
+	ErrWALMismatch = errors.New("WAL record mismatches the searcher")
+	// error of a log record longer than maxWALRecordLen
+	ErrWALRecordTooLarge = errors.New("WAL record too large")
+)
+
+// WALSyncPolicy decides when the log file of a WALSearcher is synced to the
+// disk.
+type WALSyncPolicy int
+
+const (
+	// The log file is synced after each record.
+	WALSyncAlways WALSyncPolicy = iota
+	// The log file is synced when a record is appended at least
+	// WALOptions.Interval after the last sync.
+	WALSyncInterval
+	// Syncing is left to the OS. Records survive a crash of the process, but
+	// may be lost if the machine crashes.
+	WALSyncNever
+)
+
+// WALOptions are options of a WALSearcher.
+type WALOptions struct {
+	Sync WALSyncPolicy
+	// the interval for WALSyncInterval
+	Interval time.Duration
+}
+
+// walOp is the operation of a log record.
+type walOp byte
+
+const (
+	walAddDoc walOp = iota + 1
+	walAddDocTokens
+	walDeleteDoc
+	walUpdateDoc
+	walAddDocNumeric
+	walSetSortString
+	walCompact
+)
+
+// walRecord is a record in the log file. Each record is saved as
+//
+//	length(4 bytes) crc32(4 bytes) gob-encoded walRecord(length bytes)
+//
+// where the integers are big-endian, and the checksum is of the encoded
+// record.
+type walRecord struct {
+	Op walOp
+	// the doc deleted
+	DocID int32
+	// the expected ID of the doc added
+	NewDocID int32
+	// tokens of the doc added. Orders of tokens are kept for walAddDocTokens.
+	Fields map[string][]string
+	Data   interface{}
+	// numeric fields of the doc added by walAddDocNumeric
+	Nums NumericFields
+	// the field and the value of walSetSortString
+	Field, Value string
+}
+
+const (
+	// the length of the header of a saved record
+	walRecordHeaderLen = 8
+	// the maximum length of an encoded record. A header with a larger length
+	// is treated as partially written.
+	maxWALRecordLen = 64 << 20
+
+	walMagic         = "GOIDXWAL"
+	walSnapshotMagic = "GOIDXWSS"
+	// the length of the header of a log file, i.e. walMagic followed by the
+	// big-endian epoch
+	walHeaderLen             = len(walMagic) + 8
+	walSnapshotFormatVersion = 1
+)
+
+// apply applies the record to s.
+func (rec *walRecord) apply(s *TokenSetSearcher) error {
+	switch rec.Op {
+	case walSetSortString:
+		if err := s.SetSortString(rec.DocID, rec.Field, rec.Value); err != nil {
+			return ErrWALMismatch
+		}
+		return nil
+	case walCompact:
+		s.Compact()
+		return nil
+	}
+	if rec.Op == walDeleteDoc || rec.Op == walUpdateDoc {
+		if err := s.DeleteDoc(rec.DocID); err != nil {
+			return ErrWALMismatch
+		}
+	}
+	if rec.Op == walDeleteDoc {
+		return nil
+	}
+	if int(rec.NewDocID) != len(s.docs) {
+		return ErrWALMismatch
+	}
+	if rec.Op == walAddDocTokens {
+		s.AddDocTokens(rec.Fields, rec.Data)
+		return nil
+	}
+	fields := make(map[string]stringsp.Set, len(rec.Fields))
+	for fld, tokens := range rec.Fields {
+		fields[fld] = stringsp.NewSet(tokens...)
+	}
+	if rec.Op == walAddDocNumeric {
+		s.AddDocNumeric(fields, rec.Nums, rec.Data)
+		return nil
+	}
+	s.AddDoc(fields, rec.Data)
+	return nil
+}
+
+// replayWAL applies the records read from r to s. The replaying stops at the
+// end of r or at a record partially written or corrupted, e.g. by a crash,
+// and the length of the valid records is returned.
+func replayWAL(s *TokenSetSearcher, r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var valid int64
+	var header [walRecordHeaderLen]byte
+	for {
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return valid, nil
+			}
+			return valid, err
+		}
+		n := binary.BigEndian.Uint32(header[:4])
+		if n > maxWALRecordLen {
+			return valid, nil
+		}
+		// The buffer grows with the bytes actually read, so a torn header
+		// does not allocate the whole length.
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, br, int64(n)); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return valid, nil
+			}
+			return valid, err
+		}
+		bs := buf.Bytes()
+		if crc32.ChecksumIEEE(bs) != binary.BigEndian.Uint32(header[4:]) {
+			return valid, nil
+		}
+		var rec walRecord
+		if err := gob.NewDecoder(bytes.NewReader(bs)).Decode(&rec); err != nil {
+			return valid, nil
+		}
+		if err := rec.apply(s); err != nil {
+			return valid, err
+		}
+		valid += int64(len(header) + len(bs))
+	}
+}
+
+// loadWALSnapshot loads s from a snapshot file saved by
+// WALSearcher.Checkpoint, and returns its epoch. A missing file is treated as
+// an empty searcher of epoch 0. A file saved by TokenSetSearcher.Save is also
+// accepted, with epoch 0.
+func loadWALSnapshot(s *TokenSetSearcher, fn string) (uint64, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errorsp.WithStacks(err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	version, ok, err := readHeader(br, walSnapshotMagic)
+	if err != nil {
+		return 0, err
+	}
+	var epoch uint64
+	if ok {
+		if version != walSnapshotFormatVersion {
+			return 0, ErrUnsupportedVersion
+		}
+		if err := readSection(br, func(dec *gob.Decoder) error {
+			return dec.Decode(&epoch)
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return epoch, s.Load(br)
+}
+
+// replayWALFile replays the log file f on s loaded from the snapshot of epoch.
+// It returns the offset after the valid records, or -1 if the log has no
+// valid header or was written before the snapshot, i.e. it contains no
+// records to replay.
+func replayWALFile(s *TokenSetSearcher, epoch uint64, f io.Reader) (int64, error) {
+	var header [walHeaderLen]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return -1, nil
+		}
+		return -1, errorsp.WithStacks(err)
+	}
+	if string(header[:len(walMagic)]) != walMagic {
+		return -1, nil
+	}
+	switch logEpoch := binary.BigEndian.Uint64(header[len(walMagic):]); {
+	case logEpoch < epoch:
+		return -1, nil
+	case logEpoch > epoch:
+		// the log follows a newer snapshot
+		return -1, ErrWALMismatch
+	}
+	valid, err := replayWAL(s, f)
+	return int64(walHeaderLen) + valid, err
+}
+
+// RecoverWAL returns the searcher recovered by replaying the log file on the
+// snapshot file, without modifying the files. Missing files are treated as
+// empty.
+func RecoverWAL(snapshot, log string) (*TokenSetSearcher, error) {
+	s := &TokenSetSearcher{}
+	epoch, err := loadWALSnapshot(s, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(log)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, errorsp.WithStacks(err)
+	}
+	defer f.Close()
+	if _, err := replayWALFile(s, epoch, f); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// WALSearcher is a TokenSetSearcher whose mutations are logged in an
+// append-only file before being applied, so that they can be recovered after
+// a crash by replaying the log on the last snapshot. Checkpoint saves a new
+// snapshot and empties the log.
+//
+// Like TokenSetSearcher, a WALSearcher is not safe for concurrent use.
+type WALSearcher struct {
+	s        TokenSetSearcher
+	snapshot string
+	f        *os.File
+	opts     WALOptions
+	lastSync time.Time
+	// increased by each checkpoint, saved in both the snapshot and the log,
+	// so that a log written before the snapshot is not replayed
+	epoch uint64
+	// if not nil, the log may not be consistent with the searcher, and
+	// mutations fail with it until a checkpoint succeeds
+	err error
+}
+
+// OpenWALSearcher recovers the searcher like RecoverWAL, and opens the log
+// file for appending further mutations. A partially written record at the end
+// of the log is truncated. If opts is nil, WALSyncAlways is used.
+func OpenWALSearcher(snapshot, log string, opts *WALOptions) (*WALSearcher, error) {
+	ws := &WALSearcher{snapshot: snapshot}
+	if opts != nil {
+		ws.opts = *opts
+	}
+	epoch, err := loadWALSnapshot(&ws.s, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	ws.epoch = epoch
+	f, err := os.OpenFile(log, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errorsp.WithStacks(err)
+	}
+	ws.f = f
+	valid, err := replayWALFile(&ws.s, epoch, f)
+	if err == nil {
+		if valid < 0 {
+			err = ws.resetLog()
+		} else {
+			// removes the partially written record, if any
+			err = ws.truncateLog(valid)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ws.lastSync = time.Now()
+	return ws, nil
+}
+
+// truncateLog truncates the log to size, and moves the offset to the end.
+func (ws *WALSearcher) truncateLog(size int64) error {
+	if err := ws.f.Truncate(size); err != nil {
+		return errorsp.WithStacks(err)
+	}
+	_, err := ws.f.Seek(size, io.SeekStart)
+	return errorsp.WithStacks(err)
+}
+
+// resetLog empties the log, and writes the header with the current epoch.
+func (ws *WALSearcher) resetLog() error {
+	if err := ws.truncateLog(0); err != nil {
+		return err
+	}
+	var header [walHeaderLen]byte
+	copy(header[:], walMagic)
+	binary.BigEndian.PutUint64(header[len(walMagic):], ws.epoch)
+	if _, err := ws.f.Write(header[:]); err != nil {
+		return errorsp.WithStacks(err)
+	}
+	return ws.sync()
+}
+
+// Searcher returns the underlying searcher for searching. It must not be
+// modified directly, otherwise the modifications are not logged.
+func (ws *WALSearcher) Searcher() *TokenSetSearcher {
+	return &ws.s
+}
+
+// append writes a record to the log and syncs it according to the policy. If
+// writing or syncing fails, the record may or may not be in the log, so the
+// WAL is marked failed.
+func (ws *WALSearcher) append(rec *walRecord) error {
+	if ws.err != nil {
+		return ws.err
+	}
+	var buf bytes.Buffer
+	buf.Write(make([]byte, walRecordHeaderLen))
+	if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+		return errorsp.WithStacks(err)
+	}
+	bs := buf.Bytes()
+	if len(bs)-walRecordHeaderLen > maxWALRecordLen {
+		return ErrWALRecordTooLarge
+	}
+	binary.BigEndian.PutUint32(bs[:4], uint32(len(bs)-walRecordHeaderLen))
+	binary.BigEndian.PutUint32(bs[4:8], crc32.ChecksumIEEE(bs[walRecordHeaderLen:]))
+	if _, err := ws.f.Write(bs); err != nil {
+		ws.err = errorsp.WithStacks(err)
+		return ws.err
+	}
+	switch ws.opts.Sync {
+	case WALSyncAlways:
+		ws.err = ws.sync()
+	case WALSyncInterval:
+		if time.Since(ws.lastSync) >= ws.opts.Interval {
+			ws.err = ws.sync()
+		}
+	}
+	return ws.err
+}
+
+func (ws *WALSearcher) sync() error {
+	ws.lastSync = time.Now()
+	return errorsp.WithStacks(ws.f.Sync())
+}
+
+func setsToSlices(fields map[string]stringsp.Set) map[string][]string {
+	res := make(map[string][]string, len(fields))
+	for fld, tokens := range fields {
+		res[fld] = tokens.Elements()
+	}
+	return res
+}
+
+// AddDoc logs and applies TokenSetSearcher.AddDoc. If logging fails, the doc
+// is not added.
+func (ws *WALSearcher) AddDoc(fields map[string]stringsp.Set, data interface{}) (int32, error) {
+	docID := int32(len(ws.s.docs))
+	if err := ws.append(&walRecord{
+		Op:       walAddDoc,
+		NewDocID: docID,
+		Fields:   setsToSlices(fields),
+		Data:     data,
+	}); err != nil {
+		return -1, err
+	}
+	return ws.s.AddDoc(fields, data), nil
+}
+
+// AddDocTokens logs and applies TokenSetSearcher.AddDocTokens. If logging
+// fails, the doc is not added.
+func (ws *WALSearcher) AddDocTokens(fields map[string][]string, data interface{}) (int32, error) {
+	docID := int32(len(ws.s.docs))
+	if err := ws.append(&walRecord{
+		Op:       walAddDocTokens,
+		NewDocID: docID,
+		Fields:   fields,
+		Data:     data,
+	}); err != nil {
+		return -1, err
+	}
+	return ws.s.AddDocTokens(fields, data), nil
+}
+
+// AddDocNumeric logs and applies TokenSetSearcher.AddDocNumeric. If logging
+// fails, the doc is not added.
+func (ws *WALSearcher) AddDocNumeric(fields map[string]stringsp.Set, nums NumericFields, data interface{}) (int32, error) {
+	docID := int32(len(ws.s.docs))
+	if err := ws.append(&walRecord{
+		Op:       walAddDocNumeric,
+		NewDocID: docID,
+		Fields:   setsToSlices(fields),
+		Nums:     nums,
+		Data:     data,
+	}); err != nil {
+		return -1, err
+	}
+	return ws.s.AddDocNumeric(fields, nums, data), nil
+}
+
+// SetSortString logs and applies TokenSetSearcher.SetSortString.
+func (ws *WALSearcher) SetSortString(docID int32, field, value string) error {
+	if docID < 0 || int(docID) >= len(ws.s.docs) {
+		return ErrInvalidDocID
+	}
+	if err := ws.append(&walRecord{Op: walSetSortString, DocID: docID, Field: field, Value: value}); err != nil {
+		return err
+	}
+	return ws.s.SetSortString(docID, field, value)
+}
+
+// DeleteDoc logs and applies TokenSetSearcher.DeleteDoc.
+func (ws *WALSearcher) DeleteDoc(docID int32) error {
+	if docID < 0 || int(docID) >= len(ws.s.docs) || ws.s.isDeleted(docID) {
+		return ErrInvalidDocID
+	}
+	if err := ws.append(&walRecord{Op: walDeleteDoc, DocID: docID}); err != nil {
+		return err
+	}
+	return ws.s.DeleteDoc(docID)
+}
+
+// UpdateDoc logs and applies TokenSetSearcher.UpdateDoc.
+func (ws *WALSearcher) UpdateDoc(docID int32, fields map[string]stringsp.Set, data interface{}) (int32, error) {
+	if docID < 0 || int(docID) >= len(ws.s.docs) || ws.s.isDeleted(docID) {
+		return -1, ErrInvalidDocID
+	}
+	if err := ws.append(&walRecord{
+		Op:       walUpdateDoc,
+		DocID:    docID,
+		NewDocID: int32(len(ws.s.docs)),
+		Fields:   setsToSlices(fields),
+		Data:     data,
+	}); err != nil {
+		return -1, err
+	}
+	return ws.s.UpdateDoc(docID, fields, data)
+}
+
+// Compact logs and applies TokenSetSearcher.Compact, and makes a checkpoint
+// to empty the log. If the checkpoint fails, the compaction is still recovered
+// by replaying the log. Nothing is logged if no docs were deleted.
+func (ws *WALSearcher) Compact() ([]int32, error) {
+	if len(ws.s.deleted) == 0 {
+		return ws.s.Compact(), nil
+	}
+	if err := ws.append(&walRecord{Op: walCompact}); err != nil {
+		return nil, err
+	}
+	return ws.s.Compact(), ws.Checkpoint()
+}
+
+// Checkpoint saves the searcher to the snapshot file, and empties the log.
+// If the log fails to be emptied after the snapshot is saved, the WAL is
+// marked failed, since further records would be appended to a log of an older
+// epoch, which is not replayed on the snapshot. A later successful Checkpoint
+// clears the failure.
+func (ws *WALSearcher) Checkpoint() error {
+	ws.epoch++
+	if err := writeFileAtomic(ws.snapshot, func(w io.Writer) error {
+		if err := writeHeader(w, walSnapshotMagic, walSnapshotFormatVersion); err != nil {
+			return err
+		}
+		if err := writeSection(w, func(enc *gob.Encoder) error {
+			return enc.Encode(ws.epoch)
+		}); err != nil {
+			return err
+		}
+		return ws.s.Save(w)
+	}); err != nil {
+		ws.epoch--
+		return err
+	}
+	// If crashed here, the log is not replayed on the new snapshot because of
+	// its older epoch.
+	ws.err = ws.resetLog()
+	return ws.err
+}
+
+// Close syncs and closes the log file. No checkpoint is made.
+func (ws *WALSearcher) Close() error {
+	err := ws.sync()
+	if e := ws.f.Close(); err == nil {
+		err = errorsp.WithStacks(e)
+	}
+	return err
+}
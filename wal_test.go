@@ -0,0 +1,150 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/golangplus/testing/assert"
+)
+
+func walSearchDocs(t *testing.T, s *TokenSetSearcher, tokens ...string) []interface{} {
+	var docs []interface{}
+	assert.NoError(t, s.Search(SingleFieldQuery("text", tokens...), func(docID int32, data interface{}) error {
+		docs = append(docs, data)
+		return nil
+	}))
+	return docs
+}
+
+func TestWALSearcher(t *testing.T) {
+	dir := path.Join(os.TempDir(), "TestWALSearcher")
+	assert.NoErrorOrDie(t, os.RemoveAll(dir))
+	assert.NoErrorOrDie(t, os.MkdirAll(dir, 0755))
+	snapshot, log := path.Join(dir, "snapshot"), path.Join(dir, "log")
+
+	ws, err := OpenWALSearcher(snapshot, log, nil)
+	assert.NoErrorOrDie(t, err)
+	for i := 0; i < 3; i++ {
+		docID, err := ws.AddDoc(shardedTestDoc(i), i)
+		assert.NoError(t, err)
+		assert.Equal(t, "docID", docID, int32(i))
+	}
+	docID, err := ws.AddDocTokens(map[string][]string{"text": {"a", "b", "c"}}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "docID", docID, int32(3))
+	assert.NoError(t, ws.DeleteDoc(1))
+	assert.Equal(t, "err", ws.DeleteDoc(1), ErrInvalidDocID)
+	docID, err = ws.UpdateDoc(2, shardedTestDoc(4), 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "docID", docID, int32(4))
+	assert.Equal(t, "a", walSearchDocs(t, ws.Searcher(), "a"), []interface{}{0, 3, 4})
+	// closing without a checkpoint, like crashing
+	assert.NoError(t, ws.Close())
+
+	s, err := RecoverWAL(snapshot, log)
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "a", walSearchDocs(t, s, "a"), []interface{}{0, 3, 4})
+	assert.Equal(t, "even", walSearchDocs(t, s, "even"), []interface{}{0, 4})
+	assert.StringEqual(t, "phrase", searchQueryDocs(t, s, Phrase{"text", []string{"b", "c"}}), "[3]")
+
+	ws, err = OpenWALSearcher(snapshot, log, &WALOptions{Sync: WALSyncNever})
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "a", walSearchDocs(t, ws.Searcher(), "a"), []interface{}{0, 3, 4})
+	oldLog, err := ioutil.ReadFile(log)
+	assert.NoErrorOrDie(t, err)
+	assert.NoError(t, ws.Checkpoint())
+	_, err = ws.AddDoc(shardedTestDoc(5), 5)
+	assert.NoError(t, err)
+	assert.NoError(t, ws.Close())
+
+	// a partially written record at the end
+	f, err := os.OpenFile(log, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoErrorOrDie(t, err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 1, 2})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	ws, err = OpenWALSearcher(snapshot, log, &WALOptions{Sync: WALSyncInterval})
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "a", walSearchDocs(t, ws.Searcher(), "a"), []interface{}{0, 3, 4, 5})
+	_, err = ws.AddDoc(shardedTestDoc(6), 6)
+	assert.NoError(t, err)
+	assert.NoError(t, ws.Close())
+
+	s, err = RecoverWAL(snapshot, log)
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "a", walSearchDocs(t, s, "a"), []interface{}{0, 3, 4, 5, 6})
+
+	// compacting makes a checkpoint
+	ws, err = OpenWALSearcher(snapshot, log, nil)
+	assert.NoErrorOrDie(t, err)
+	newIDs, err := ws.Compact()
+	assert.NoError(t, err)
+	assert.StringEqual(t, "newIDs", newIDs, "[0 -1 -1 1 2 3 4]")
+	assert.NoError(t, ws.DeleteDoc(0))
+	assert.NoError(t, ws.Close())
+
+	// the log before a checkpoint is not replayed, as if crashed right after
+	// saving the snapshot
+	assert.NoErrorOrDie(t, ioutil.WriteFile(log, oldLog, 0644))
+	ws, err = OpenWALSearcher(snapshot, log, nil)
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "a", walSearchDocs(t, ws.Searcher(), "a"), []interface{}{0, 3, 4, 5, 6})
+	assert.NoError(t, ws.Close())
+}
+
+func TestWALSearcher_Failures(t *testing.T) {
+	dir := path.Join(os.TempDir(), "TestWALSearcher_Failures")
+	assert.NoErrorOrDie(t, os.RemoveAll(dir))
+	assert.NoErrorOrDie(t, os.MkdirAll(dir, 0755))
+	snapshot, log := path.Join(dir, "snapshot"), path.Join(dir, "log")
+
+	ws, err := OpenWALSearcher(snapshot, log, nil)
+	assert.NoErrorOrDie(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := ws.AddDocNumeric(shardedTestDoc(i), NumericFields{Ints: map[string]int64{"n": int64(i)}}, i)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, ws.SetSortString(2, "s", "two"))
+	assert.Equal(t, "err", ws.SetSortString(3, "s", "three"), ErrInvalidDocID)
+	assert.NoError(t, ws.DeleteDoc(1))
+	// the checkpoint fails, but the compaction is in the log
+	ws.snapshot = path.Join(dir, "missing", "snapshot")
+	newIDs, err := ws.Compact()
+	assert.Error(t, err)
+	assert.StringEqual(t, "newIDs", newIDs, "[0 -1 1]")
+	ws.snapshot = snapshot
+	assert.NoError(t, ws.DeleteDoc(0))
+	assert.NoError(t, ws.Close())
+
+	// a header of a huge record at the end
+	f, err := os.OpenFile(log, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoErrorOrDie(t, err)
+	_, err = f.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	s, err := RecoverWAL(snapshot, log)
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "a", walSearchDocs(t, s, "a"), []interface{}{2})
+	n, ok := s.DocInt(1, "n")
+	assert.True(t, "ok", ok)
+	assert.Equal(t, "n", n, int64(2))
+	str, ok := s.DocSortString(1, "s")
+	assert.True(t, "ok", ok)
+	assert.Equal(t, "s", str, "two")
+
+	// the log fails to be emptied after the snapshot is saved
+	ws, err = OpenWALSearcher(snapshot, log, nil)
+	assert.NoErrorOrDie(t, err)
+	assert.NoError(t, ws.f.Close())
+	assert.Error(t, ws.Checkpoint())
+	_, err = ws.AddDoc(shardedTestDoc(3), 3)
+	assert.Error(t, err)
+
+	s, err = RecoverWAL(snapshot, log)
+	assert.NoErrorOrDie(t, err)
+	assert.Equal(t, "a", walSearchDocs(t, s, "a"), []interface{}{2})
+}